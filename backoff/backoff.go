@@ -0,0 +1,40 @@
+// Package backoff calculates delays for retrying failed operations.
+package backoff
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Backoff calculates exponentially growing delays with jitter.
+// Initial is the delay of the first retry, every further retry multiplies it by Multiplier
+// up to Max. Jitter (between 0 and 1) is the fraction of the delay which is randomized
+// to avoid that many clients retry at the same time.
+type Backoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+	Jitter     float64
+}
+
+// Default is a backoff starting with one second up to one minute.
+var Default = Backoff{
+	Initial:    time.Second,
+	Max:        time.Minute,
+	Multiplier: 2,
+	Jitter:     0.5,
+}
+
+// Duration returns the delay before the retry number attempt (starting with 0).
+func (b Backoff) Duration(attempt int) time.Duration {
+	delay := float64(b.Initial) * math.Pow(b.Multiplier, float64(attempt))
+	if delay > float64(b.Max) || math.IsInf(delay, 0) {
+		delay = float64(b.Max)
+	}
+
+	// Randomize the delay between (1-Jitter)*delay and delay
+	delay -= b.Jitter * delay * rand.Float64()
+
+	return time.Duration(delay)
+}
@@ -0,0 +1,36 @@
+package backoff
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDurationGrowsExponentiallyUpToMax(t *testing.T) {
+	b := Backoff{
+		Initial:    time.Second,
+		Max:        10 * time.Second,
+		Multiplier: 2,
+	}
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for attempt, e := range expected {
+		if d := b.Duration(attempt); d != e {
+			t.Errorf("Attempt %d: Expected %s, got %s", attempt, e, d)
+		}
+	}
+}
+
+func TestDurationWithJitterStaysInRange(t *testing.T) {
+	b := Backoff{
+		Initial:    time.Second,
+		Max:        time.Minute,
+		Multiplier: 2,
+		Jitter:     0.5,
+	}
+
+	for i := 0; i < 100; i++ {
+		if d := b.Duration(3); d < 4*time.Second || d > 8*time.Second {
+			t.Fatalf("Expected a delay between 4s and 8s, got %s", d)
+		}
+	}
+}
@@ -2,18 +2,22 @@ package config
 
 import (
 	"encoding/json"
-	"io/ioutil"
 )
 
 type Configuration struct {
 	Gotrap gotrapConfiguration `json:"gotrap"`
 	Github GithubConfiguration `json:"github"`
 	Amqp   AmqpConfiguration   `json:"amqp"`
+	Kafka  KafkaConfiguration  `json:"kafka"`
+	Replay ReplayConfiguration `json:"replay"`
 	Gerrit GerritConfiguration `json:"gerrit"`
+	Web    WebConfiguration    `json:"web"`
 }
 
 type gotrapConfiguration struct {
-	Concurrent int `json:"concurrent"`
+	Concurrent int    `json:"concurrent"`
+	DryRun     bool   `json:"dry-run"`
+	Stream     string `json:"stream"`
 }
 
 type GithubConfiguration struct {
@@ -26,39 +30,221 @@ type GithubConfiguration struct {
 }
 
 type githubPullRequestTemplate struct {
-	Title string   `json:"title"`
-	Body  []string `json:"body"`
-	Close string   `json:"close"`
+	Title string `json:"title"`
+	Body  Lines  `json:"body"`
+	Close string `json:"close"`
 }
 
 type AmqpConfiguration struct {
-	Host       string `json:"host"`
-	Port       int    `json:"port"`
-	Username   string `json:"username"`
-	Password   string `json:"password"`
-	VHost      string `json:"vhost"`
-	Exchange   string `json:"exchange"`
-	Queue      string `json:"queue"`
-	RoutingKey string `json:"routing-key"`
-	Identifier string `json:"identifier"`
+	Scheme             string                 `json:"scheme"`
+	Host               string                 `json:"host"`
+	Port               int                    `json:"port"`
+	Username           string                 `json:"username"`
+	Password           string                 `json:"password"`
+	SASLExternal       bool                   `json:"sasl-external"`
+	TLS                AmqpTLSConfiguration   `json:"tls"`
+	Heartbeat          int                    `json:"heartbeat"`
+	ConnectionName     string                 `json:"connection-name"`
+	VHost              string                 `json:"vhost"`
+	Exchange           string                 `json:"exchange"`
+	ExchangeType       string                 `json:"exchange-type"`
+	ExchangeDurable    bool                   `json:"exchange-durable"`
+	ExchangeAutoDelete bool                   `json:"exchange-auto-delete"`
+	Queue              string                 `json:"queue"`
+	QueueDurable       bool                   `json:"queue-durable"`
+	QueueAutoDelete    bool                   `json:"queue-auto-delete"`
+	QueueArguments     map[string]interface{} `json:"queue-arguments"`
+	Passive            bool                   `json:"passive"`
+	RoutingKey         string                 `json:"routing-key"`
+	Prefetch           int                    `json:"prefetch"`
+	Identifier         string                 `json:"identifier"`
+}
+
+type AmqpTLSConfiguration struct {
+	CAFile             string `json:"ca-file"`
+	CertFile           string `json:"cert-file"`
+	KeyFile            string `json:"key-file"`
+	ServerName         string `json:"server-name"`
+	InsecureSkipVerify bool   `json:"insecure-skip-verify"`
+}
+
+type KafkaConfiguration struct {
+	Brokers     []string `json:"brokers"`
+	Topic       string   `json:"topic"`
+	GroupID     string   `json:"group-id"`
+	StartOffset string   `json:"start-offset"`
+}
+
+type ReplayConfiguration struct {
+	File            string  `json:"file"`
+	HonorTimestamps bool    `json:"honor-timestamps"`
+	Speed           float64 `json:"speed"`
 }
 
 type GerritConfiguration struct {
-	URL            string                     `json:"url"`
-	Username       string                     `json:"username"`
-	Password       string                     `json:"password"`
-	Projects       map[string]map[string]bool `json:"projects"`
-	ExcludePattern []string                   `json:"exclude-pattern"`
-	Comment        []string                   `json:"comment"`
+	URL                string                                              `json:"url"`
+	Username           string                                              `json:"username"`
+	Password           string                                              `json:"password"`
+	Auth               GerritAuthConfiguration                             `json:"auth"`
+	SSH                GerritSSHConfiguration                              `json:"ssh"`
+	Timeout            int                                                 `json:"timeout"`
+	Retries            int                                                 `json:"retries"`
+	Projects           map[string]map[string]bool                          `json:"projects"`
+	ExcludePattern     []string                                            `json:"exclude-pattern"`
+	SkipWorkInProgress bool                                                `json:"skip-work-in-progress"`
+	SkipPrivate        bool                                                `json:"skip-private"`
+	Trust              GerritTrustConfiguration                            `json:"trust"`
+	PathFilters        map[string]map[string]GerritPathFilterConfiguration `json:"path-filters"`
+	Comment            Lines                                               `json:"comment"`
+	InlineComments     string                                              `json:"inline-comments"`
+	Review             GerritReviewConfiguration                           `json:"review"`
+	ReviewProjects     map[string]GerritReviewConfiguration                `json:"review-projects"`
+	Checks             GerritChecksConfiguration                           `json:"checks"`
+	Progress           GerritProgressConfiguration                         `json:"progress"`
+	Poll               GerritPollConfiguration                             `json:"poll"`
+}
+
+type GerritAuthConfiguration struct {
+	Type       string `json:"type"`
+	CookieFile string `json:"cookie-file"`
+	Token      string `json:"token"`
+}
+
+type GerritSSHConfiguration struct {
+	Enabled  bool     `json:"enabled"`
+	Command  string   `json:"command"`
+	Host     string   `json:"host"`
+	Port     int      `json:"port"`
+	Username string   `json:"username"`
+	KeyFile  string   `json:"key-file"`
+	Options  []string `json:"options"`
+}
+
+type GerritPathFilterConfiguration struct {
+	Include     []string `json:"include"`
+	Exclude     []string `json:"exclude"`
+	SkipMessage Lines    `json:"skip-message"`
+	SkipVote    *int     `json:"skip-vote"`
+}
+
+type GerritTrustConfiguration struct {
+	Enabled       bool     `json:"enabled"`
+	Groups        []string `json:"groups"`
+	EmailDomains  []string `json:"email-domains"`
+	ApprovalLabel string   `json:"approval-label"`
+	ApprovalValue int      `json:"approval-value"`
+	Keyword       string   `json:"keyword"`
+}
+
+type GerritReviewConfiguration struct {
+	Tag                   string              `json:"tag"`
+	Notify                string              `json:"notify"`
+	NotifyOn              map[string]string   `json:"notify-on"`
+	NotifyDetails         map[string][]string `json:"notify-details"`
+	OmitDuplicateComments bool                `json:"omit-duplicate-comments"`
+}
+
+type GerritProgressConfiguration struct {
+	Started            Lines  `json:"started"`
+	PullRequestCreated Lines  `json:"pull-request-created"`
+	StatusChanged      Lines  `json:"status-changed"`
+	Notify             string `json:"notify"`
+}
+
+type GerritChecksConfiguration struct {
+	Enabled  bool     `json:"enabled"`
+	Scheme   string   `json:"scheme"`
+	Contexts []string `json:"contexts"`
 }
 
+type GerritPollConfiguration struct {
+	Interval  int    `json:"interval"`
+	MaxAge    int    `json:"max-age"`
+	StateFile string `json:"state-file"`
+}
+
+type WebConfiguration struct {
+	Listen   string `json:"listen"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	History  int    `json:"history"`
+}
+
+// NewConfiguration reads the configuration file configFile.
+// JSON, YAML (.yaml, .yml) and TOML (.toml) are supported.
+// Further files can be merged in via "include".
+// Every setting can be overwritten by an environment variable (e.g. GOTRAP_GITHUB_API_TOKEN)
+// Credentials and connection settings can reference environment variables (${NAME})
+// or secret files (file:/run/secrets/name).
 func NewConfiguration(configFile *string) (*Configuration, error) {
-	fileContent, err := ioutil.ReadFile(*configFile)
+	content, err := readFile(*configFile, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := applyEnvOverrides(content); err != nil {
+		return nil, err
+	}
+	if err := interpolateSettings(content); err != nil {
+		return nil, err
+	}
+
+	// All formats are converted to JSON, to map them with the same rules into the configuration
+	fileContent, err := json.Marshal(content)
 	if err != nil {
 		return nil, err
 	}
 
-	var config Configuration
+	// Defaults for settings which are not part of the configuration file
+	config := Configuration{
+		Gotrap: gotrapConfiguration{
+			Stream: "amqp",
+		},
+		Amqp: AmqpConfiguration{
+			Scheme:       "amqp",
+			Heartbeat:    10,
+			ExchangeType: "fanout",
+			QueueDurable: true,
+		},
+		Kafka: KafkaConfiguration{
+			GroupID:     "gotrap",
+			StartOffset: "last",
+		},
+		Replay: ReplayConfiguration{
+			File:  "-",
+			Speed: 1,
+		},
+		Gerrit: GerritConfiguration{
+			Auth: GerritAuthConfiguration{
+				Type: "basic",
+			},
+			SSH: GerritSSHConfiguration{
+				Command: "ssh",
+				Port:    29418,
+			},
+			Timeout:            30,
+			Retries:            3,
+			SkipWorkInProgress: true,
+			SkipPrivate:        true,
+			Trust: GerritTrustConfiguration{
+				ApprovalValue: 1,
+				Keyword:       "ok-to-test",
+			},
+			Checks: GerritChecksConfiguration{
+				Scheme: "gotrap",
+			},
+			Progress: GerritProgressConfiguration{
+				Notify: "NONE",
+			},
+			Poll: GerritPollConfiguration{
+				Interval: 60,
+				MaxAge:   86400,
+			},
+		},
+		Web: WebConfiguration{
+			History: 50,
+		},
+	}
 	err = json.Unmarshal(fileContent, &config)
 	if err != nil {
 		return nil, err
@@ -66,3 +252,55 @@ func NewConfiguration(configFile *string) (*Configuration, error) {
 
 	return &config, nil
 }
+
+// HasProject returns true if project is configured.
+func (c *GerritConfiguration) HasProject(project string) bool {
+	_, ok := c.Projects[project]
+
+	return ok
+}
+
+// HasBranch returns true if branch of project is configured.
+// If no branch is configured for project, all branches are covered.
+func (c *GerritConfiguration) HasBranch(project, branch string) bool {
+	if len(c.Projects[project]) == 0 {
+		return true
+	}
+
+	return c.Projects[project][branch]
+}
+
+// ReviewSettings returns the review settings of project.
+// Settings in gerrit.review-projects replace gerrit.review completely for this project.
+func (c *GerritConfiguration) ReviewSettings(project string) GerritReviewConfiguration {
+	if settings, ok := c.ReviewProjects[project]; ok {
+		return settings
+	}
+
+	return c.Review
+}
+
+// PathFilter returns the path filter of project and branch.
+// The filter of branch "*" is used for all branches without an own filter.
+// ok is false, if no filter is configured.
+func (c *GerritConfiguration) PathFilter(project, branch string) (GerritPathFilterConfiguration, bool) {
+	if filter, ok := c.PathFilters[project][branch]; ok {
+		return filter, true
+	}
+	filter, ok := c.PathFilters[project]["*"]
+
+	return filter, ok
+}
+
+// Secrets returns all configured credentials (tokens and passwords).
+// They are used to remove secrets from the log output.
+// The cookies of gerrit.auth.cookie-file are not part of it, see gerrit.CookieFileSecrets.
+func (c *Configuration) Secrets() []string {
+	return []string{
+		c.Github.APIToken,
+		c.Amqp.Password,
+		c.Gerrit.Password,
+		c.Gerrit.Auth.Token,
+		c.Web.Password,
+	}
+}
@@ -0,0 +1,218 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// envPrefix is the prefix of all environment variables overriding a setting.
+const envPrefix = "GOTRAP_"
+
+// secretFilePrefix marks a value which is read from a file (e.g. "file:/run/secrets/github-token").
+const secretFilePrefix = "file:"
+
+// envReference matches references to environment variables like ${GITHUB_TOKEN}.
+// $${GITHUB_TOKEN} is an escaped reference and results in the literal ${GITHUB_TOKEN}.
+var envReference = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// interpolatedSettings are the settings which can reference environment variables and secret files:
+// credentials and connection settings. All other settings (e.g. templates and regular expressions)
+// are taken literally, because "${" can be a valid part of them.
+// The list is documented in the README (section "Secrets and environment variables").
+var interpolatedSettings = []string{
+	"github.api-token", "github.organisation", "github.repository",
+	"amqp.host", "amqp.username", "amqp.password", "amqp.vhost",
+	"amqp.tls.ca-file", "amqp.tls.cert-file", "amqp.tls.key-file", "amqp.tls.server-name",
+	"kafka.brokers", "kafka.topic",
+	"replay.file",
+	"gerrit.url", "gerrit.username", "gerrit.password", "gerrit.auth.cookie-file", "gerrit.auth.token",
+	"gerrit.ssh.host", "gerrit.ssh.username", "gerrit.ssh.key-file", "gerrit.poll.state-file",
+	"web.listen", "web.username", "web.password",
+}
+
+// applyEnvOverrides overwrites settings in content by environment variables.
+// The name of the variable is derived from the path of the setting,
+// e.g. GOTRAP_GITHUB_API_TOKEN for "github.api-token" or GOTRAP_AMQP_PORT for "amqp.port".
+// Only single values (strings, numbers, booleans and multiline fields) can be overwritten.
+// An environment variable for a list or a map is reported as error.
+func applyEnvOverrides(content map[string]interface{}) error {
+	return applyEnvOverridesForType(content, reflect.TypeOf(Configuration{}), nil)
+}
+
+func applyEnvOverridesForType(content map[string]interface{}, t reflect.Type, path []string) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if len(name) == 0 || name == "-" {
+			continue
+		}
+		fieldPath := append(append([]string(nil), path...), name)
+
+		if field.Type.Kind() == reflect.Struct {
+			if err := applyEnvOverridesForType(content, field.Type, fieldPath); err != nil {
+				return err
+			}
+			continue
+		}
+
+		envName := envVariableName(fieldPath)
+		value, ok := os.LookupEnv(envName)
+		if !ok {
+			continue
+		}
+
+		// Optional settings (pointers) are set like their values
+		kind := field.Type.Kind()
+		if kind == reflect.Ptr {
+			kind = field.Type.Elem().Kind()
+		}
+
+		var converted interface{}
+		switch {
+		case field.Type == reflect.TypeOf(Lines{}) || kind == reflect.String:
+			converted = value
+		case kind == reflect.Int:
+			if _, err := strconv.Atoi(value); err != nil {
+				return fmt.Errorf("%s needs to be a number: %s", envName, err)
+			}
+			converted = json.Number(value)
+		case kind == reflect.Float64:
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				return fmt.Errorf("%s needs to be a number: %s", envName, err)
+			}
+			converted = json.Number(value)
+		case kind == reflect.Bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("%s needs to be a boolean: %s", envName, err)
+			}
+			converted = b
+		default:
+			// Lists and maps can`t be configured by a single environment variable
+			return fmt.Errorf("%s can't be set, because lists and maps can't be overwritten by an environment variable", envName)
+		}
+
+		setPath(content, fieldPath, converted)
+	}
+
+	return nil
+}
+
+// envVariableName returns the name of the environment variable for the setting path.
+func envVariableName(path []string) string {
+	name := strings.Join(path, "_")
+	name = strings.Replace(name, "-", "_", -1)
+
+	return envPrefix + strings.ToUpper(name)
+}
+
+// setPath sets value in content at path. Missing maps on the way are created.
+func setPath(content map[string]interface{}, path []string, value interface{}) {
+	for _, key := range path[:len(path)-1] {
+		next, ok := content[key].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			content[key] = next
+		}
+		content = next
+	}
+
+	content[path[len(path)-1]] = value
+}
+
+// interpolateSettings resolves references to environment variables and secret files
+// in the interpolatedSettings of content.
+func interpolateSettings(content map[string]interface{}) error {
+	for _, setting := range interpolatedSettings {
+		path := strings.Split(setting, ".")
+		value, ok := getPath(content, path)
+		if !ok {
+			continue
+		}
+
+		resolved, err := interpolate(value)
+		if err != nil {
+			return fmt.Errorf("%s: %s", setting, err)
+		}
+		setPath(content, path, resolved)
+	}
+
+	return nil
+}
+
+// getPath returns the value in content at path.
+func getPath(content map[string]interface{}, path []string) (interface{}, bool) {
+	for _, key := range path[:len(path)-1] {
+		next, ok := content[key].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		content = next
+	}
+
+	value, ok := content[path[len(path)-1]]
+	return value, ok
+}
+
+// interpolate resolves references to environment variables (${NAME}) and
+// secret files (file:/path/to/secret) in all strings of value.
+func interpolate(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return interpolateString(v)
+	case map[string]interface{}:
+		for key, val := range v {
+			resolved, err := interpolate(val)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", key, err)
+			}
+			v[key] = resolved
+		}
+		return v, nil
+	case []interface{}:
+		for i, val := range v {
+			resolved, err := interpolate(val)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = resolved
+		}
+		return v, nil
+	}
+
+	return value, nil
+}
+
+func interpolateString(s string) (string, error) {
+	if strings.HasPrefix(s, secretFilePrefix) {
+		fileName := strings.TrimPrefix(s, secretFilePrefix)
+		content, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			return "", fmt.Errorf("Reading secret file failed: %s", err)
+		}
+		return strings.TrimRight(string(content), "\r\n"), nil
+	}
+
+	var err error
+	resolved := envReference.ReplaceAllStringFunc(s, func(reference string) string {
+		// Escaped reference
+		if strings.HasPrefix(reference, "$$") {
+			return reference[1:]
+		}
+
+		name := envReference.FindStringSubmatch(reference)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("Environment variable %s is not set", name)
+		}
+		return value
+	})
+
+	return resolved, err
+}
@@ -0,0 +1,190 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// maxIncludeDepth limits nested includes to detect include cycles.
+const maxIncludeDepth = 10
+
+// Lines is a multiline text.
+// It can be configured as a single (multiline) string or as an array of lines.
+type Lines []string
+
+// UnmarshalJSON accepts a string or an array of strings.
+func (l *Lines) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*l = Lines{text}
+		return nil
+	}
+
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err != nil {
+		return err
+	}
+	*l = lines
+
+	return nil
+}
+
+// String joins all lines with a new line.
+func (l Lines) String() string {
+	return strings.Join(l, "\n")
+}
+
+// readFile reads the configuration file configFile including all files referenced by "include".
+// The format (JSON, YAML or TOML) is selected by the file extension.
+// The content of included files is merged into the content of the including file.
+func readFile(configFile string, depth int) (map[string]interface{}, error) {
+	if depth > maxIncludeDepth {
+		return nil, fmt.Errorf("Too many nested includes in %s", configFile)
+	}
+
+	fileContent, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := decode(configFile, fileContent)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", configFile, err)
+	}
+
+	includes, err := includePatterns(content["include"])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", configFile, err)
+	}
+	delete(content, "include")
+
+	for _, pattern := range includes {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(configFile), pattern)
+		}
+
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: Invalid include pattern \"%s\": %s", configFile, pattern, err)
+		}
+		sort.Strings(files)
+
+		for _, file := range files {
+			included, err := readFile(file, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			merge(content, included)
+		}
+	}
+
+	return content, nil
+}
+
+// decode parses data into a generic map.
+// The format is selected by the extension of fileName.
+// Everything which is not YAML or TOML is parsed as JSON.
+func decode(fileName string, data []byte) (map[string]interface{}, error) {
+	content := make(map[string]interface{})
+
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".yaml", ".yml":
+		var raw interface{}
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, err
+		}
+		if raw == nil {
+			return content, nil
+		}
+		m, ok := normalize(raw).(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Configuration needs to be a mapping")
+		}
+		content = m
+
+	case ".toml":
+		if _, err := toml.Decode(string(data), &content); err != nil {
+			return nil, err
+		}
+
+	default:
+		// UseNumber keeps numbers as they are instead of converting them into float64
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&content); err != nil {
+			return nil, err
+		}
+	}
+
+	return content, nil
+}
+
+// normalize converts all maps with non-string keys (as produced by YAML) into maps with string keys.
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			m[fmt.Sprint(key)] = normalize(val)
+		}
+		return m
+	case map[string]interface{}:
+		for key, val := range v {
+			v[key] = normalize(val)
+		}
+		return v
+	case []interface{}:
+		for i, val := range v {
+			v[i] = normalize(val)
+		}
+		return v
+	}
+
+	return value
+}
+
+// includePatterns returns the glob patterns of the "include" setting.
+// It can be a single pattern or an array of patterns.
+func includePatterns(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		patterns := make([]string, 0, len(v))
+		for _, p := range v {
+			pattern, ok := p.(string)
+			if !ok {
+				return nil, fmt.Errorf("include needs to be a list of strings")
+			}
+			patterns = append(patterns, pattern)
+		}
+		return patterns, nil
+	}
+
+	return nil, fmt.Errorf("include needs to be a string or a list of strings")
+}
+
+// merge merges src into dst.
+// Maps are merged recursively, every other value of src replaces the value in dst.
+func merge(dst, src map[string]interface{}) {
+	for key, srcValue := range src {
+		srcMap, srcIsMap := srcValue.(map[string]interface{})
+		dstMap, dstIsMap := dst[key].(map[string]interface{})
+
+		if srcIsMap && dstIsMap {
+			merge(dstMap, srcMap)
+			continue
+		}
+		dst[key] = srcValue
+	}
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestNewConfigurationMergesIncludesOfDifferentFormats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotrap-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	configFile := writeFile(t, dir, "config.yaml", `
+include: conf.d/*
+gotrap:
+  concurrent: 2
+gerrit:
+  url: https://review.typo3.org/
+  projects:
+    Packages/TYPO3.CMS:
+      master: true
+  comment: |
+    Github tests: {{ .CombinedStatus.State }}
+    Pull request: {{ .PullRequest.HTMLURL }}
+`)
+	writeFile(t, dir, "conf.d/10-project.toml", `
+[gerrit.projects."Packages/TYPO3.Fluid"]
+master = true
+`)
+	writeFile(t, dir, "conf.d/20-amqp.json", `{"amqp": {"port": 5672}}`)
+
+	c, err := NewConfiguration(&configFile)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if c.Gotrap.Concurrent != 2 {
+		t.Errorf("Expected concurrent 2, got %d", c.Gotrap.Concurrent)
+	}
+	if c.Amqp.Port != 5672 {
+		t.Errorf("Expected port 5672, got %d", c.Amqp.Port)
+	}
+	for _, project := range []string{"Packages/TYPO3.CMS", "Packages/TYPO3.Fluid"} {
+		if !c.Gerrit.Projects[project]["master"] {
+			t.Errorf("Expected project %s with branch master, got %v", project, c.Gerrit.Projects)
+		}
+	}
+	if expected := "Github tests: {{ .CombinedStatus.State }}\nPull request: {{ .PullRequest.HTMLURL }}\n"; c.Gerrit.Comment.String() != expected {
+		t.Errorf("Expected comment %q, got %q", expected, c.Gerrit.Comment.String())
+	}
+}
+
+func TestNewConfigurationResolvesEnvironmentAndSecretFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotrap-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	secretFile := writeFile(t, dir, "secrets/gerrit-password", "s3cr3t\n")
+	configFile := writeFile(t, dir, "config.json", `{
+		"github": {"api-token": "${GOTRAP_TEST_TOKEN}", "organisation": "$${literal}"},
+		"gerrit": {"password": "file:`+secretFile+`", "comment": "Build ${BUILD_ID}", "exclude-pattern": ["^\\${WIP}"]}
+	}`)
+
+	defer setenv(t, "GOTRAP_TEST_TOKEN", "token")()
+	defer setenv(t, "GOTRAP_AMQP_PORT", "5671")()
+
+	c, err := NewConfiguration(&configFile)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if c.Github.APIToken != "token" {
+		t.Errorf("Expected api-token \"token\", got %q", c.Github.APIToken)
+	}
+	if c.Github.Organisation != "${literal}" {
+		t.Errorf("Expected organisation \"${literal}\", got %q", c.Github.Organisation)
+	}
+	if c.Gerrit.Password != "s3cr3t" {
+		t.Errorf("Expected password \"s3cr3t\", got %q", c.Gerrit.Password)
+	}
+	if c.Amqp.Port != 5671 {
+		t.Errorf("Expected port 5671, got %d", c.Amqp.Port)
+	}
+	// Templates and regular expressions are not interpolated
+	if c.Gerrit.Comment.String() != "Build ${BUILD_ID}" || c.Gerrit.ExcludePattern[0] != "^\\${WIP}" {
+		t.Errorf("Expected comment and exclude-pattern unchanged, got %q and %q", c.Gerrit.Comment.String(), c.Gerrit.ExcludePattern)
+	}
+}
+
+func TestNewConfigurationOverwritesFloatsAndRejectsLists(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotrap-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	configFile := writeFile(t, dir, "config.json", `{"kafka": {"brokers": ["kafka:9092"]}}`)
+
+	defer setenv(t, "GOTRAP_REPLAY_SPEED", "2.5")()
+	c, err := NewConfiguration(&configFile)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if c.Replay.Speed != 2.5 {
+		t.Errorf("Expected speed 2.5, got %f", c.Replay.Speed)
+	}
+
+	// A list can`t be set by a single variable, which must not be ignored silently
+	defer setenv(t, "GOTRAP_KAFKA_BROKERS", "other:9092")()
+	if _, err := NewConfiguration(&configFile); err == nil || !strings.Contains(err.Error(), "GOTRAP_KAFKA_BROKERS") {
+		t.Errorf("Expected an error for GOTRAP_KAFKA_BROKERS, got %v", err)
+	}
+}
+
+// setenv sets the environment variable name to value.
+// The returned function restores the previous state.
+func setenv(t *testing.T, name, value string) func() {
+	previous, existed := os.LookupEnv(name)
+	if err := os.Setenv(name, value); err != nil {
+		t.Fatal(err)
+	}
+
+	return func() {
+		if existed {
+			os.Setenv(name, previous)
+		} else {
+			os.Unsetenv(name)
+		}
+	}
+}
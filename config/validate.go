@@ -0,0 +1,223 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// checkerScheme matches valid schemes of checker UUIDs of the Gerrit checks plugin.
+var checkerScheme = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+
+// notifyValues are the valid notify settings of a Gerrit review.
+var notifyValues = map[string]bool{
+	"NONE":            true,
+	"OWNER":           true,
+	"OWNER_REVIEWERS": true,
+	"ALL":             true,
+}
+
+// reviewOutcomes are the outcomes of a verification which can have their own notify setting.
+var reviewOutcomes = map[string]bool{
+	"success": true,
+	"failure": true,
+	"error":   true,
+}
+
+// ValidationError contains all problems found in a configuration.
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return "Invalid configuration:\n\t" + strings.Join(e, "\n\t")
+}
+
+// Validate checks the configuration for problems which would otherwise only show up at runtime,
+// like template syntax errors, invalid regular expressions or missing settings.
+// All problems are returned together as ValidationError.
+func (c *Configuration) Validate() error {
+	var errs ValidationError
+
+	required := func(name, value string) {
+		if len(strings.TrimSpace(value)) == 0 {
+			errs = append(errs, fmt.Sprintf("%s is required", name))
+		}
+	}
+	positive := func(name string, value int) {
+		if value <= 0 {
+			errs = append(errs, fmt.Sprintf("%s needs to be greater than 0", name))
+		}
+	}
+	parseTemplate := func(name, text string) {
+		if _, err := template.New(name).Parse(text); err != nil {
+			errs = append(errs, fmt.Sprintf("%s is not a valid template: %s", name, err))
+		}
+	}
+
+	// gotrap
+	positive("gotrap.concurrent", c.Gotrap.Concurrent)
+
+	// github
+	required("github.api-token", c.Github.APIToken)
+	required("github.organisation", c.Github.Organisation)
+	required("github.repository", c.Github.Repository)
+	positive("github.branch-polling-intervall", c.Github.BranchPollingIntervall)
+	positive("github.status-polling-intervall", c.Github.StatusPollingIntervall)
+	required("github.pull-request.title", c.Github.PRTemplate.Title)
+	parseTemplate("github.pull-request.title", c.Github.PRTemplate.Title)
+	parseTemplate("github.pull-request.body", c.Github.PRTemplate.Body.String())
+	parseTemplate("github.pull-request.close", c.Github.PRTemplate.Close)
+
+	// stream
+	switch c.Gotrap.Stream {
+	case "amqp":
+		if c.Amqp.Scheme != "amqp" && c.Amqp.Scheme != "amqps" {
+			errs = append(errs, fmt.Sprintf("amqp.scheme needs to be \"amqp\" or \"amqps\", got \"%s\"", c.Amqp.Scheme))
+		}
+		required("amqp.host", c.Amqp.Host)
+		positive("amqp.port", c.Amqp.Port)
+		if (len(c.Amqp.TLS.CertFile) == 0) != (len(c.Amqp.TLS.KeyFile) == 0) {
+			errs = append(errs, "amqp.tls.cert-file and amqp.tls.key-file need to be configured together")
+		}
+		if c.Amqp.SASLExternal && (c.Amqp.Scheme != "amqps" || len(c.Amqp.TLS.CertFile) == 0) {
+			errs = append(errs, "amqp.sasl-external requires amqp.scheme \"amqps\" and a client certificate")
+		}
+		if c.Amqp.Heartbeat < 0 {
+			errs = append(errs, "amqp.heartbeat must not be negative")
+		}
+		required("amqp.exchange", c.Amqp.Exchange)
+		switch t := c.Amqp.ExchangeType; {
+		case t == "direct" || t == "fanout" || t == "topic" || t == "headers" || strings.HasPrefix(t, "x-"):
+		default:
+			errs = append(errs, fmt.Sprintf("amqp.exchange-type \"%s\" is not a valid exchange type", t))
+		}
+		required("amqp.queue", c.Amqp.Queue)
+		if c.Amqp.Prefetch < 0 {
+			errs = append(errs, "amqp.prefetch must not be negative")
+		}
+	case "kafka":
+		if len(c.Kafka.Brokers) == 0 {
+			errs = append(errs, "kafka.brokers needs at least one broker")
+		}
+		required("kafka.topic", c.Kafka.Topic)
+		required("kafka.group-id", c.Kafka.GroupID)
+		if c.Kafka.StartOffset != "first" && c.Kafka.StartOffset != "last" {
+			errs = append(errs, fmt.Sprintf("kafka.start-offset needs to be \"first\" or \"last\", got \"%s\"", c.Kafka.StartOffset))
+		}
+	case "gerrit-poll":
+		positive("gerrit.poll.interval", c.Gerrit.Poll.Interval)
+		positive("gerrit.poll.max-age", c.Gerrit.Poll.MaxAge)
+	case "replay":
+		required("replay.file", c.Replay.File)
+		if c.Replay.Speed <= 0 {
+			errs = append(errs, "replay.speed needs to be greater than 0")
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("gotrap.stream needs to be \"amqp\", \"kafka\", \"gerrit-poll\" or \"replay\", got \"%s\"", c.Gotrap.Stream))
+	}
+
+	// gerrit
+	required("gerrit.url", c.Gerrit.URL)
+	if u, err := url.Parse(c.Gerrit.URL); len(c.Gerrit.URL) > 0 && (err != nil || len(u.Scheme) == 0 || len(u.Host) == 0) {
+		errs = append(errs, fmt.Sprintf("gerrit.url \"%s\" is not a valid URL", c.Gerrit.URL))
+	}
+	switch c.Gerrit.Auth.Type {
+	case "basic":
+	case "none":
+		// The anonymous REST API can't post reviews
+		if !c.Gerrit.SSH.Enabled {
+			errs = append(errs, "gerrit.auth.type \"none\" needs gerrit.ssh.enabled to post reviews")
+		}
+	case "digest":
+		required("gerrit.username", c.Gerrit.Username)
+		required("gerrit.password", c.Gerrit.Password)
+	case "cookie-file":
+		required("gerrit.auth.cookie-file", c.Gerrit.Auth.CookieFile)
+	case "bearer":
+		required("gerrit.auth.token", c.Gerrit.Auth.Token)
+	default:
+		errs = append(errs, fmt.Sprintf("gerrit.auth.type needs to be \"basic\", \"digest\", \"cookie-file\", \"bearer\" or \"none\", got \"%s\"", c.Gerrit.Auth.Type))
+	}
+	if c.Gerrit.SSH.Enabled {
+		required("gerrit.ssh.command", c.Gerrit.SSH.Command)
+		positive("gerrit.ssh.port", c.Gerrit.SSH.Port)
+	}
+	positive("gerrit.timeout", c.Gerrit.Timeout)
+	if c.Gerrit.Retries < 0 {
+		errs = append(errs, "gerrit.retries must not be negative")
+	}
+	if len(c.Gerrit.Projects) == 0 {
+		errs = append(errs, "gerrit.projects needs at least one project")
+	}
+	for _, pattern := range c.Gerrit.ExcludePattern {
+		if _, err := regexp.Compile(pattern); err != nil {
+			errs = append(errs, fmt.Sprintf("gerrit.exclude-pattern \"%s\" is not a valid regular expression: %s", pattern, err))
+		}
+	}
+	parseTemplate("gerrit.comment", c.Gerrit.Comment.String())
+	switch c.Gerrit.InlineComments {
+	case "", "comments", "robot-comments":
+	default:
+		errs = append(errs, fmt.Sprintf("gerrit.inline-comments needs to be \"comments\" or \"robot-comments\", got \"%s\"", c.Gerrit.InlineComments))
+	}
+	validateReview := func(name string, r GerritReviewConfiguration) {
+		if len(r.Notify) > 0 && !notifyValues[r.Notify] {
+			errs = append(errs, fmt.Sprintf("%s.notify needs to be NONE, OWNER, OWNER_REVIEWERS or ALL, got \"%s\"", name, r.Notify))
+		}
+		for outcome, notify := range r.NotifyOn {
+			if !reviewOutcomes[outcome] {
+				errs = append(errs, fmt.Sprintf("%s.notify-on: unknown outcome \"%s\" (success, failure or error)", name, outcome))
+			}
+			if !notifyValues[notify] {
+				errs = append(errs, fmt.Sprintf("%s.notify-on.%s needs to be NONE, OWNER, OWNER_REVIEWERS or ALL, got \"%s\"", name, outcome, notify))
+			}
+		}
+		for recipientType := range r.NotifyDetails {
+			if recipientType != "TO" && recipientType != "CC" && recipientType != "BCC" {
+				errs = append(errs, fmt.Sprintf("%s.notify-details: unknown recipient type \"%s\" (TO, CC or BCC)", name, recipientType))
+			}
+		}
+	}
+	validateReview("gerrit.review", c.Gerrit.Review)
+	for project, r := range c.Gerrit.ReviewProjects {
+		validateReview(fmt.Sprintf("gerrit.review-projects.%s", project), r)
+	}
+	parseTemplate("gerrit.progress.started", c.Gerrit.Progress.Started.String())
+	parseTemplate("gerrit.progress.pull-request-created", c.Gerrit.Progress.PullRequestCreated.String())
+	parseTemplate("gerrit.progress.status-changed", c.Gerrit.Progress.StatusChanged.String())
+	if !notifyValues[c.Gerrit.Progress.Notify] {
+		errs = append(errs, fmt.Sprintf("gerrit.progress.notify needs to be NONE, OWNER, OWNER_REVIEWERS or ALL, got \"%s\"", c.Gerrit.Progress.Notify))
+	}
+	for project, branches := range c.Gerrit.PathFilters {
+		for branch, filter := range branches {
+			name := fmt.Sprintf("gerrit.path-filters.%s.%s", project, branch)
+			for _, pattern := range append(append([]string{}, filter.Include...), filter.Exclude...) {
+				required(name+" pattern", pattern)
+			}
+			parseTemplate(name+".skip-message", filter.SkipMessage.String())
+		}
+	}
+	if c.Gerrit.Trust.Enabled {
+		if len(c.Gerrit.Trust.Groups) == 0 && len(c.Gerrit.Trust.EmailDomains) == 0 {
+			errs = append(errs, "gerrit.trust needs at least one group or email domain")
+		}
+		if len(c.Gerrit.Trust.ApprovalLabel) > 0 {
+			positive("gerrit.trust.approval-value", c.Gerrit.Trust.ApprovalValue)
+		}
+	}
+	if c.Gerrit.Checks.Enabled && !checkerScheme.MatchString(c.Gerrit.Checks.Scheme) {
+		errs = append(errs, fmt.Sprintf("gerrit.checks.scheme \"%s\" may only contain letters, digits, \".\", \"_\" and \"-\"", c.Gerrit.Checks.Scheme))
+	}
+
+	// web
+	if c.Web.History < 0 {
+		errs = append(errs, "web.history must not be negative")
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
@@ -0,0 +1,170 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func validConfiguration() *Configuration {
+	return &Configuration{
+		Gotrap: gotrapConfiguration{Concurrent: 1, Stream: "amqp"},
+		Github: GithubConfiguration{
+			APIToken:               "token",
+			Organisation:           "typo3-ci",
+			Repository:             "TYPO3.CMS-pre-merge-tests",
+			BranchPollingIntervall: 15,
+			StatusPollingIntervall: 30,
+			PRTemplate: githubPullRequestTemplate{
+				Title: "Gotrap: {{.Change.Subject}}",
+				Body:  Lines{"{{.Change.CommitMessage}}"},
+				Close: "Closed",
+			},
+		},
+		Amqp: AmqpConfiguration{
+			Scheme:       "amqp",
+			Host:         "mq.typo3.org",
+			Port:         5672,
+			Exchange:     "gerrit",
+			ExchangeType: "fanout",
+			Queue:        "gotrap",
+		},
+		Gerrit: GerritConfiguration{
+			URL:            "https://review.typo3.org/",
+			Auth:           GerritAuthConfiguration{Type: "basic"},
+			Timeout:        30,
+			Projects:       map[string]map[string]bool{"Packages/TYPO3.CMS": {}},
+			ExcludePattern: []string{"^\\[WIP\\].*"},
+			Comment:        Lines{"Github tests: {{ .CombinedStatus.State }}"},
+			Progress:       GerritProgressConfiguration{Notify: "NONE"},
+		},
+	}
+}
+
+func TestValidateAcceptsValidConfiguration(t *testing.T) {
+	if err := validConfiguration().Validate(); err != nil {
+		t.Errorf("Expected no error, got %s", err)
+	}
+}
+
+func TestValidateReportsAllProblems(t *testing.T) {
+	c := validConfiguration()
+	c.Github.PRTemplate.Title = "{{.Change.Subject"
+	c.Gerrit.ExcludePattern = []string{"^[WIP"}
+	c.Github.StatusPollingIntervall = 0
+
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("Expected an error, got nil")
+	}
+
+	for _, expected := range []string{"github.pull-request.title", "gerrit.exclude-pattern", "github.status-polling-intervall"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error to mention %s, got %s", expected, err)
+		}
+	}
+}
+
+func TestValidateReviewSettings(t *testing.T) {
+	c := validConfiguration()
+	c.Gerrit.Review = GerritReviewConfiguration{
+		Tag:      "autogenerated:gotrap",
+		Notify:   "OWNER",
+		NotifyOn: map[string]string{"success": "NONE"},
+	}
+	c.Gerrit.ReviewProjects = map[string]GerritReviewConfiguration{
+		"Packages/TYPO3.CMS": {NotifyOn: map[string]string{"broken": "EVERYBODY"}, NotifyDetails: map[string][]string{"FROM": nil}},
+	}
+
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("Expected an error, got nil")
+	}
+
+	for _, expected := range []string{"unknown outcome \"broken\"", "notify-on.broken", "unknown recipient type \"FROM\""} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error to mention %s, got %s", expected, err)
+		}
+	}
+	if strings.Contains(err.Error(), "gerrit.review.") {
+		t.Errorf("Expected gerrit.review to be valid, got %s", err)
+	}
+
+	if settings := c.Gerrit.ReviewSettings("Packages/Other"); settings.Tag != "autogenerated:gotrap" {
+		t.Errorf("Expected the default review settings, got %+v", settings)
+	}
+}
+
+func TestValidateGerritAuth(t *testing.T) {
+	c := validConfiguration()
+	c.Gerrit.Auth.Type = "cookie-file"
+	c.Gerrit.SSH = GerritSSHConfiguration{Enabled: true, Command: "ssh"}
+
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("Expected an error, got nil")
+	}
+
+	for _, expected := range []string{"gerrit.auth.cookie-file is required", "gerrit.ssh.port"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error to mention %s, got %s", expected, err)
+		}
+	}
+
+	c.Gerrit.Auth.Type = "kerberos"
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "gerrit.auth.type") {
+		t.Errorf("Expected error to mention gerrit.auth.type, got %v", err)
+	}
+
+	c = validConfiguration()
+	c.Gerrit.Auth.Type = "none"
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "gerrit.ssh.enabled") {
+		t.Errorf("Expected error to mention gerrit.ssh.enabled, got %v", err)
+	}
+	c.Gerrit.SSH = GerritSSHConfiguration{Enabled: true, Command: "ssh", Port: 29418}
+	if err := c.Validate(); err != nil {
+		t.Errorf("Expected no error with SSH reviews, got %s", err)
+	}
+}
+
+func TestValidateTrustNeedsGroupsOrEmailDomains(t *testing.T) {
+	c := validConfiguration()
+	c.Gerrit.Trust = GerritTrustConfiguration{Enabled: true, ApprovalLabel: "Code-Review"}
+
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("Expected an error, got nil")
+	}
+
+	for _, expected := range []string{"gerrit.trust needs at least one group or email domain", "gerrit.trust.approval-value"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error to mention %s, got %s", expected, err)
+		}
+	}
+}
+
+func TestPathFilterFallsBackToAllBranches(t *testing.T) {
+	c := validConfiguration()
+	c.Gerrit.PathFilters = map[string]map[string]GerritPathFilterConfiguration{
+		"Packages/TYPO3.CMS": {
+			"*":      {Exclude: []string{"**/*.md"}},
+			"master": {Include: []string{"typo3/**", ""}, SkipMessage: Lines{"{{ .Change.Subject"}},
+		},
+	}
+
+	if filter, ok := c.Gerrit.PathFilter("Packages/TYPO3.CMS", "TYPO3_8-7"); !ok || len(filter.Exclude) != 1 {
+		t.Errorf("Expected the filter of all branches, got %+v", filter)
+	}
+	if _, ok := c.Gerrit.PathFilter("Packages/Other", "master"); ok {
+		t.Error("Expected no filter for an unconfigured project")
+	}
+
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("Expected an error, got nil")
+	}
+	for _, expected := range []string{"gerrit.path-filters.Packages/TYPO3.CMS.master pattern is required", "gerrit.path-filters.Packages/TYPO3.CMS.master.skip-message"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error to mention %s, got %s", expected, err)
+		}
+	}
+}
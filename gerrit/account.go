@@ -0,0 +1,34 @@
+package gerrit
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// VerifyCredentials checks if the configured credentials are accepted by Gerrit.
+// It only reads the account of the configured user.
+// Without credentials (anonymous access), it only checks if the REST API is reachable.
+// @link https://review.typo3.org/Documentation/rest-api-accounts.html#get-account
+func (g GerritInstance) VerifyCredentials() error {
+	urlToCall := fmt.Sprintf("%s/accounts/self", g.getAPIUrl(true))
+	if g.Anonymous {
+		urlToCall = fmt.Sprintf("%s/config/server/version", g.getAPIUrl(false))
+	}
+
+	return g.call(context.Background(), "GET", urlToCall, nil, nil)
+}
+
+// ListGroupMembers returns the members of the group (name or UUID)
+// including the members of all included groups.
+// @link https://review.typo3.org/Documentation/rest-api-groups.html#group-members
+func (g GerritInstance) ListGroupMembers(ctx context.Context, group string) ([]AccountInfo, error) {
+	urlToCall := fmt.Sprintf("%s/groups/%s/members/?recursive", g.getAPIUrl(true), url.PathEscape(group))
+
+	var members []AccountInfo
+	if err := g.call(ctx, "GET", urlToCall, nil, &members); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
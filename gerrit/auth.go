@@ -0,0 +1,332 @@
+package gerrit
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/andygrunwald/gotrap/config"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Authenticator adds credentials to the requests to the REST API of Gerrit.
+type Authenticator interface {
+	Authenticate(req *http.Request) error
+}
+
+// challenger is implemented by authenticators which need the answer
+// to an unauthenticated request (401) first, like digest auth.
+// Challenge returns true if the request should be sent again.
+type challenger interface {
+	Challenge(resp *http.Response) bool
+}
+
+// NewAuthenticator returns the authenticator for gerrit.auth.type.
+// With type "none", nil is returned and only the anonymous REST API is used.
+func NewAuthenticator(c *config.GerritConfiguration) Authenticator {
+	switch c.Auth.Type {
+	case "none":
+		return nil
+	case "digest":
+		return &DigestAuth{Username: c.Username, Password: c.Password}
+	case "cookie-file":
+		return &CookieFileAuth{File: c.Auth.CookieFile}
+	case "bearer":
+		return &BearerAuth{Token: c.Auth.Token}
+	default:
+		return &BasicAuth{Username: c.Username, Password: c.Password}
+	}
+}
+
+// BasicAuth authenticates with HTTP basic auth (default since Gerrit 2.14).
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+func (a *BasicAuth) Authenticate(req *http.Request) error {
+	req.SetBasicAuth(a.Username, a.Password)
+	return nil
+}
+
+// BearerAuth authenticates with an OAuth token (e.g. for Gerrit hosts behind an OAuth proxy).
+type BearerAuth struct {
+	Token string
+}
+
+func (a *BearerAuth) Authenticate(req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+a.Token)
+	return nil
+}
+
+// CookieFileAuth authenticates with the cookies of a cookie file in the Netscape format,
+// like the .gitcookies used by googlesource.com.
+// The file is read on every request, because tools like
+// git-cookie-authdaemon replace the cookies regularly.
+type CookieFileAuth struct {
+	File string
+}
+
+func (a *CookieFileAuth) Authenticate(req *http.Request) error {
+	f, err := os.Open(a.File)
+	if err != nil {
+		return fmt.Errorf("Reading cookie file failed: %s", err)
+	}
+	defer f.Close()
+
+	cookies, err := parseCookieFile(bufio.NewScanner(f))
+	if err != nil {
+		return fmt.Errorf("Reading cookie file %s failed: %s", a.File, err)
+	}
+
+	for _, c := range cookies {
+		if c.matches(req.URL, time.Now()) {
+			req.AddCookie(&http.Cookie{Name: c.name, Value: c.value})
+		}
+	}
+
+	return nil
+}
+
+// CookieFileSecrets returns the values of all cookies in the cookie file,
+// to remove them from the log output.
+// Without a file (or if it can`t be read), there are no secrets.
+func CookieFileSecrets(file string) []string {
+	if len(file) == 0 {
+		return nil
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	cookies, _ := parseCookieFile(bufio.NewScanner(f))
+	secrets := make([]string, 0, len(cookies))
+	for _, c := range cookies {
+		secrets = append(secrets, c.value)
+	}
+
+	return secrets
+}
+
+// fileCookie is a single line of a cookie file.
+type fileCookie struct {
+	domain     string
+	subdomains bool
+	path       string
+	secure     bool
+	expires    int64
+	name       string
+	value      string
+}
+
+// matches returns true if the cookie needs to be sent with a request to u.
+func (c fileCookie) matches(u *url.URL, now time.Time) bool {
+	host := u.Hostname()
+	domain := strings.TrimPrefix(c.domain, ".")
+	if host != domain && !(c.subdomains && strings.HasSuffix(host, "."+domain)) {
+		return false
+	}
+	if c.secure && u.Scheme != "https" {
+		return false
+	}
+	if c.expires > 0 && c.expires < now.Unix() {
+		return false
+	}
+
+	return strings.HasPrefix(u.Path, c.path)
+}
+
+// parseCookieFile reads the cookies of a cookie file in the Netscape format.
+// Every line contains domain, subdomains, path, secure, expiry, name and value separated by tabs.
+func parseCookieFile(scanner *bufio.Scanner) ([]fileCookie, error) {
+	var cookies []fileCookie
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		// curl marks HttpOnly cookies with a prefix instead of a column
+		text = strings.TrimPrefix(text, "#HttpOnly_")
+		if len(text) == 0 || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Split(text, "\t")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("line %d: expected 7 fields separated by tabs, got %d", line, len(fields))
+		}
+
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid expiry \"%s\"", line, fields[4])
+		}
+
+		cookies = append(cookies, fileCookie{
+			domain:     fields[0],
+			subdomains: strings.EqualFold(fields[1], "TRUE"),
+			path:       fields[2],
+			secure:     strings.EqualFold(fields[3], "TRUE"),
+			expires:    expires,
+			name:       fields[5],
+			value:      fields[6],
+		})
+	}
+
+	return cookies, scanner.Err()
+}
+
+// DigestAuth authenticates with HTTP digest auth (RFC 2617),
+// which older Gerrit versions (before 2.14) require for the REST API.
+// The first request is answered with a challenge (401), which is used for all following requests.
+type DigestAuth struct {
+	Username string
+	Password string
+
+	mu        sync.Mutex
+	challenge map[string]string
+	count     int
+}
+
+func (a *DigestAuth) Authenticate(req *http.Request) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// Without a challenge, Gerrit answers with one
+	if a.challenge == nil {
+		return nil
+	}
+
+	a.count++
+	cnonce, err := newCnonce()
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", a.authorization(req.Method, req.URL.RequestURI(), cnonce))
+	return nil
+}
+
+// authorization builds the Authorization header for a request to uri.
+func (a *DigestAuth) authorization(method, uri, cnonce string) string {
+	realm := a.challenge["realm"]
+	nonce := a.challenge["nonce"]
+
+	ha1 := md5Hex(a.Username + ":" + realm + ":" + a.Password)
+	ha2 := md5Hex(method + ":" + uri)
+
+	header := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", algorithm=MD5`, a.Username, realm, nonce, uri)
+	if qop := a.qop(); len(qop) > 0 {
+		nc := fmt.Sprintf("%08x", a.count)
+		response := md5Hex(ha1 + ":" + nonce + ":" + nc + ":" + cnonce + ":" + qop + ":" + ha2)
+		header += fmt.Sprintf(`, qop=%s, nc=%s, cnonce="%s", response="%s"`, qop, nc, cnonce, response)
+	} else {
+		header += fmt.Sprintf(`, response="%s"`, md5Hex(ha1+":"+nonce+":"+ha2))
+	}
+	if opaque, ok := a.challenge["opaque"]; ok {
+		header += fmt.Sprintf(`, opaque="%s"`, opaque)
+	}
+
+	return header
+}
+
+// qop returns "auth" if the challenge offers it.
+// Older servers don`t offer a qop at all.
+func (a *DigestAuth) qop() string {
+	for _, qop := range strings.Split(a.challenge["qop"], ",") {
+		if strings.TrimSpace(qop) == "auth" {
+			return "auth"
+		}
+	}
+
+	return ""
+}
+
+// Challenge stores the digest challenge of resp.
+// If Gerrit rejects the credentials with the same nonce again,
+// the request is not repeated.
+func (a *DigestAuth) Challenge(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusUnauthorized {
+		return false
+	}
+
+	for _, header := range resp.Header["Www-Authenticate"] {
+		challenge, ok := parseDigestChallenge(header)
+		if !ok {
+			continue
+		}
+		if algorithm, ok := challenge["algorithm"]; ok && !strings.EqualFold(algorithm, "MD5") {
+			continue
+		}
+
+		a.mu.Lock()
+		defer a.mu.Unlock()
+
+		rejected := a.challenge != nil && a.challenge["nonce"] == challenge["nonce"] && !strings.EqualFold(challenge["stale"], "true")
+		a.challenge = challenge
+		a.count = 0
+
+		return !rejected
+	}
+
+	return false
+}
+
+// parseDigestChallenge parses a WWW-Authenticate header like
+// `Digest realm="Gerrit Code Review", qop="auth", nonce="..."`.
+func parseDigestChallenge(header string) (map[string]string, bool) {
+	const scheme = "digest "
+	if len(header) < len(scheme) || !strings.EqualFold(header[:len(scheme)], scheme) {
+		return nil, false
+	}
+
+	challenge := make(map[string]string)
+	for _, param := range splitChallenge(header[len(scheme):]) {
+		parts := strings.SplitN(param, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		challenge[strings.ToLower(strings.TrimSpace(parts[0]))] = strings.Trim(strings.TrimSpace(parts[1]), `"`)
+	}
+
+	return challenge, true
+}
+
+// splitChallenge splits the parameters of a challenge at all commas outside of quotes.
+func splitChallenge(s string) []string {
+	var params []string
+
+	quoted := false
+	start := 0
+	for i, c := range s {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			params = append(params, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(params, s[start:])
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func newCnonce() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,199 @@
+package gerrit
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDigestAuthAnswersChallenge(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		header := r.Header.Get("Authorization")
+		if len(header) == 0 {
+			w.Header().Set("WWW-Authenticate", `Digest realm="Gerrit Code Review", domain="/", qop="auth", nonce="abc,def", opaque="xyz"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		challenge, _ := parseDigestChallenge(header)
+		ha1 := md5Hex("jenkins:Gerrit Code Review:s3cr3t")
+		ha2 := md5Hex(r.Method + ":" + challenge["uri"])
+		expected := md5Hex(ha1 + ":abc,def:" + challenge["nc"] + ":" + challenge["cnonce"] + ":auth:" + ha2)
+		if challenge["response"] != expected || challenge["opaque"] != "xyz" || challenge["uri"] != r.URL.RequestURI() {
+			t.Errorf("Unexpected authorization %s", header)
+		}
+	}))
+	defer ts.Close()
+
+	g := &GerritInstance{URL: ts.URL, Auth: &DigestAuth{Username: "jenkins", Password: "s3cr3t"}}
+	for i := 0; i < 2; i++ {
+		if err := g.VerifyCredentials(); err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+	}
+
+	// The challenge is reused for the second request
+	if calls != 3 {
+		t.Errorf("Expected 3 calls, got %d", calls)
+	}
+}
+
+func TestDigestAuthStopsOnRejectedCredentials(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("WWW-Authenticate", `Digest realm="Gerrit Code Review", qop="auth", nonce="abc"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer ts.Close()
+
+	g := &GerritInstance{URL: ts.URL, Auth: &DigestAuth{Username: "jenkins", Password: "wrong"}}
+	if err := g.VerifyCredentials(); err == nil {
+		t.Fatal("Expected an error, got nil")
+	}
+	if calls != 2 {
+		t.Errorf("Expected 2 calls, got %d", calls)
+	}
+}
+
+func TestCookieFileAuthSendsMatchingCookies(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cookie := r.Header.Get("Cookie"); cookie != "o=git-jenkins=1/abc" {
+			t.Errorf("Unexpected cookies %q", cookie)
+		}
+	}))
+	defer ts.Close()
+
+	host, _ := url.Parse(ts.URL)
+	f, err := ioutil.TempFile("", "gitcookies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	fmt.Fprintf(f, "# Netscape HTTP Cookie File\n")
+	fmt.Fprintf(f, "%s\tFALSE\t/\tFALSE\t2147483647\to\tgit-jenkins=1/abc\n", host.Hostname())
+	fmt.Fprintf(f, "%s\tFALSE\t/\tTRUE\t2147483647\tsecure\tonly-https\n", host.Hostname())
+	fmt.Fprintf(f, ".googlesource.com\tTRUE\t/\tTRUE\t2147483647\to\tgit-other=1/def\n")
+	f.Close()
+
+	g := &GerritInstance{URL: ts.URL, Auth: &CookieFileAuth{File: f.Name()}}
+	if err := g.VerifyCredentials(); err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	// All cookies of the file are removed from the log output
+	secrets := CookieFileSecrets(f.Name())
+	if len(secrets) != 3 || secrets[0] != "git-jenkins=1/abc" || secrets[2] != "git-other=1/def" {
+		t.Errorf("Unexpected secrets %v", secrets)
+	}
+	if secrets := CookieFileSecrets(""); len(secrets) != 0 {
+		t.Errorf("Expected no secrets without cookie file, got %v", secrets)
+	}
+}
+
+// countingAuth counts the authentication attempts.
+type countingAuth struct {
+	Authenticator
+	calls int
+}
+
+func (a *countingAuth) Authenticate(req *http.Request) error {
+	a.calls++
+	return a.Authenticator.Authenticate(req)
+}
+
+func TestAuthenticationErrorsAreNotRetried(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	defer ts.Close()
+
+	auth := &countingAuth{Authenticator: &CookieFileAuth{File: "/does/not/exist"}}
+	g := &GerritInstance{URL: ts.URL, Auth: auth, Retries: 3}
+	if err := g.VerifyCredentials(); err == nil || !strings.Contains(err.Error(), "Reading cookie file") {
+		t.Fatalf("Expected a cookie file error, got %v", err)
+	}
+	if auth.calls != 1 || calls != 0 {
+		t.Errorf("Expected a single attempt without request to Gerrit, got %d attempts and %d requests", auth.calls, calls)
+	}
+}
+
+func TestFileCookieMatches(t *testing.T) {
+	cookies, err := parseCookieFile(bufio.NewScanner(strings.NewReader(
+		"#HttpOnly_.googlesource.com\tTRUE\t/\tTRUE\t2147483647\to\tgit-user=1/abc\n" +
+			"review.typo3.org\tFALSE\t/a/\tFALSE\t1\texpired\tyes\n")))
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if len(cookies) != 2 {
+		t.Fatalf("Expected 2 cookies, got %d", len(cookies))
+	}
+
+	now := time.Now()
+	tests := []struct {
+		cookie   fileCookie
+		url      string
+		expected bool
+	}{
+		{cookies[0], "https://gerrit-review.googlesource.com/a/changes/", true},
+		{cookies[0], "http://gerrit-review.googlesource.com/a/changes/", false},
+		{cookies[0], "https://googlesource.com.example.org/a/changes/", false},
+		{cookies[1], "https://review.typo3.org/a/changes/", false},
+	}
+	for _, test := range tests {
+		u, _ := url.Parse(test.url)
+		if matches := test.cookie.matches(u, now); matches != test.expected {
+			t.Errorf("Expected %s to match %s: %t, got %t", test.cookie.name, test.url, test.expected, matches)
+		}
+	}
+
+	if _, err := parseCookieFile(bufio.NewScanner(strings.NewReader("review.typo3.org o abc\n"))); err == nil {
+		t.Error("Expected an error for a line without tabs, got nil")
+	}
+}
+
+func TestBearerAuthAndAnonymousAccess(t *testing.T) {
+	var paths, headers []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		headers = append(headers, r.Header.Get("Authorization"))
+	}))
+	defer ts.Close()
+
+	m := &Message{Change: Change{ID: "I1"}, Patchset: Patchset{Revision: "abc"}}
+	(&GerritInstance{URL: ts.URL, Auth: &BearerAuth{Token: "t0ken"}}).PostReview(context.Background(), m, &ReviewInput{})
+	(&GerritInstance{URL: ts.URL, Anonymous: true}).PostReview(context.Background(), m, &ReviewInput{})
+
+	if paths[0] != "/a/changes/I1/revisions/abc/review" || headers[0] != "Bearer t0ken" {
+		t.Errorf("Expected an authenticated request, got %s with %q", paths[0], headers[0])
+	}
+	if paths[1] != "/changes/I1/revisions/abc/review" || headers[1] != "" {
+		t.Errorf("Expected an anonymous request, got %s with %q", paths[1], headers[1])
+	}
+}
+
+func TestSSHReviewerArgs(t *testing.T) {
+	s := &SSHReviewer{Command: "ssh", Host: "review.typo3.org", Port: 29418, Username: "jenkins", KeyFile: "/keys/id_rsa", Options: []string{"-o", "StrictHostKeyChecking=yes"}}
+
+	args := strings.Join(s.args("gerrit", "review", "--json", sshQuote("Packages/TYPO3.CMS"), "abc"), " ")
+	expected := "-p 29418 -o BatchMode=yes -i /keys/id_rsa -o StrictHostKeyChecking=yes jenkins@review.typo3.org gerrit review --json 'Packages/TYPO3.CMS' abc"
+	if args != expected {
+		t.Errorf("Expected %q, got %q", expected, args)
+	}
+}
+
+func TestSSHQuoteEscapesSingleQuotes(t *testing.T) {
+	if quoted, expected := sshQuote("it's master"), `'it'\''s master'`; quoted != expected {
+		t.Errorf("Expected %s, got %s", expected, quoted)
+	}
+}
@@ -0,0 +1,56 @@
+package gerrit
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// changeDetailOptions are the additional fields requested for the details of a change.
+var changeDetailOptions = []string{"CURRENT_REVISION", "CURRENT_COMMIT", "CURRENT_FILES", "DETAILED_LABELS", "DETAILED_ACCOUNTS", "MESSAGES"}
+
+// ChangeDetails are the details of a change which are not part of a stream event,
+// like the owner, labels, files and related changes.
+type ChangeDetails struct {
+	// Change contains the current revision with its commit and files
+	Change *ChangeInfo
+	// Related are the changes which depend on the revision or which the revision depends on
+	Related []RelatedChangeAndCommitInfo
+}
+
+// GetChangeDetails returns the details of the change changeID
+// and the related changes of its revision revisionID.
+// The related changes are optional: If they can`t be requested, the details contain none.
+func (g GerritInstance) GetChangeDetails(ctx context.Context, changeID, revisionID string) (*ChangeDetails, error) {
+	change, err := g.getChange(ctx, changeID, changeDetailOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	related, err := g.GetRelatedChanges(ctx, changeID, revisionID)
+	if err != nil {
+		log.Printf("> Requesting the related changes of change id \"%s\" failed: %s", changeID, err)
+	}
+
+	return &ChangeDetails{
+		Change:  change,
+		Related: related,
+	}, nil
+}
+
+// GetRelatedChanges returns the changes which depend on the revision revisionID
+// of the change changeID or which it depends on (newest first).
+// @link https://review.typo3.org/Documentation/rest-api-changes.html#get-related-changes
+func (g GerritInstance) GetRelatedChanges(ctx context.Context, changeID, revisionID string) ([]RelatedChangeAndCommitInfo, error) {
+	urlToCall := fmt.Sprintf("%s/changes/%s/revisions/%s/related", g.getAPIUrl(false), changeID, revisionID)
+
+	var related struct {
+		Changes []RelatedChangeAndCommitInfo `json:"changes"`
+	}
+	if err := g.call(ctx, "GET", urlToCall, nil, &related); err != nil {
+		return nil, err
+	}
+	log.Printf("> %d related changes for change id \"%s\" received", len(related.Changes), changeID)
+
+	return related.Changes, nil
+}
@@ -0,0 +1,122 @@
+package gerrit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeGerrit answers the requests for the details of change 36909 like Gerrit does.
+func fakeGerrit(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, ")]}'\n")
+
+		switch r.URL.Path {
+		case "/changes/I4c3f6b3/":
+			if o := r.URL.Query()["o"]; len(o) != len(changeDetailOptions) {
+				t.Errorf("Unexpected options %v", o)
+			}
+			fmt.Fprint(w, `{
+				"project": "Packages/TYPO3.CMS",
+				"branch": "master",
+				"topic": "fluid",
+				"hashtags": ["performance"],
+				"change_id": "I4c3f6b3",
+				"subject": "[TASK] Cache view helpers",
+				"status": "NEW",
+				"_number": 36909,
+				"insertions": 12,
+				"deletions": 3,
+				"work_in_progress": true,
+				"owner": {"_account_id": 1000096, "name": "John Doe", "email": "john.doe@example.com", "username": "jdoe"},
+				"labels": {
+					"Code-Review": {
+						"recommended": {"_account_id": 1000097, "name": "Jane Roe"},
+						"all": [{"_account_id": 1000097, "name": "Jane Roe", "value": 1}]
+					}
+				},
+				"current_revision": "184ebe53805e102605d11f6b143486d15c23a09c",
+				"revisions": {
+					"184ebe53805e102605d11f6b143486d15c23a09c": {
+						"_number": 2,
+						"ref": "refs/changes/09/36909/2",
+						"commit": {
+							"parents": [{"commit": "1eee2c9d8f352483781e772f35dc586a69ff5646", "subject": "[BUGFIX] Fix the cache"}],
+							"subject": "[TASK] Cache view helpers"
+						},
+						"files": {
+							"typo3/sysext/fluid/Classes/ViewHelper.php": {"lines_inserted": 12, "lines_deleted": 3},
+							"typo3/sysext/fluid/Classes/Cache.php": {"status": "A", "lines_inserted": 5}
+						}
+					}
+				}
+			}`)
+		case "/changes/I4c3f6b3/revisions/184ebe53805e102605d11f6b143486d15c23a09c/related":
+			fmt.Fprint(w, `{"changes": [{
+				"project": "Packages/TYPO3.CMS",
+				"change_id": "I5e4fc08",
+				"commit": {"commit": "1eee2c9d8f352483781e772f35dc586a69ff5646", "subject": "[BUGFIX] Fix the cache"},
+				"_change_number": 36908,
+				"_revision_number": 1,
+				"_current_revision_number": 3,
+				"status": "NEW"
+			}]}`)
+		default:
+			t.Errorf("Unexpected request %s", r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestGetChangeDetails(t *testing.T) {
+	ts := fakeGerrit(t)
+	defer ts.Close()
+
+	g := &GerritInstance{URL: ts.URL}
+	details, err := g.GetChangeDetails(context.Background(), "I4c3f6b3", "184ebe53805e102605d11f6b143486d15c23a09c")
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	c := details.Change
+	if c.Owner.Username != "jdoe" || c.Topic != "fluid" || len(c.Hashtags) != 1 || !c.WorkInProgress || c.IsPrivate {
+		t.Errorf("Unexpected change %+v", c)
+	}
+	if label := c.Labels["Code-Review"]; label.Recommended == nil || label.Recommended.Name != "Jane Roe" || len(label.All) != 1 || label.All[0].Value != 1 {
+		t.Errorf("Unexpected label %+v", label)
+	}
+
+	revision := c.Revisions[c.CurrentRevision]
+	if len(revision.Files) != 2 || revision.Files["typo3/sysext/fluid/Classes/Cache.php"].Status != "A" {
+		t.Errorf("Unexpected files %+v", revision.Files)
+	}
+	if len(revision.Commit.Parents) != 1 || revision.Commit.Parents[0].Subject != "[BUGFIX] Fix the cache" {
+		t.Errorf("Unexpected parents %+v", revision.Commit.Parents)
+	}
+
+	if len(details.Related) != 1 || details.Related[0].Number != 36908 || details.Related[0].CurrentRevisionNumber != 3 {
+		t.Errorf("Unexpected related changes %+v", details.Related)
+	}
+}
+
+func TestGetChangeDetailsWithoutRelatedChanges(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/changes/I4c3f6b3/revisions/abc/related" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"_number": 36909, "status": "NEW", "current_revision": "abc"}`)
+	}))
+	defer ts.Close()
+
+	g := &GerritInstance{URL: ts.URL}
+	details, err := g.GetChangeDetails(context.Background(), "I4c3f6b3", "abc")
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if details.Change.Number != 36909 || len(details.Related) != 0 {
+		t.Errorf("Expected change 36909 without related changes, got %+v", details)
+	}
+}
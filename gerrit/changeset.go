@@ -1,88 +1,121 @@
 package gerrit
 
 import (
-	"encoding/json"
-	"errors"
+	"context"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net/http"
+	"net/url"
 	"strings"
 )
 
-func (g GerritInstance) GetChangeInformation(changeID string) (*ChangeInfo, error) {
-	urlToCall := fmt.Sprintf("%s/changes/%s/?o=CURRENT_REVISION", g.getAPIUrl(false), changeID)
-	log.Printf("> Calling %s\n", urlToCall)
-
-	client := &http.Client{}
-	req, _ := http.NewRequest("GET", urlToCall, nil)
-	req.SetBasicAuth(g.Username, g.Password)
-	req.Header.Add("Content-Type", "application/json;charset=UTF-8")
+// GetChangeInformation returns the change including the current revision.
+func (g GerritInstance) GetChangeInformation(ctx context.Context, changeID string) (*ChangeInfo, error) {
+	return g.getChange(ctx, changeID, "CURRENT_REVISION")
+}
 
-	resp, err := client.Do(req)
-	defer resp.Body.Close()
+// GetChangeWithAllRevisions returns the change including all revisions and their commits.
+// changeID can be everything Gerrit accepts as change identifier (e.g. Change-Id or change number).
+func (g GerritInstance) GetChangeWithAllRevisions(ctx context.Context, changeID string) (*ChangeInfo, error) {
+	return g.getChange(ctx, changeID, "ALL_REVISIONS", "ALL_COMMITS")
+}
 
-	if err != nil {
-		return nil, err
+// NewPatchsetCreatedMessage builds a synthetic "patchset-created" message
+// for the patchset with the number patchsetNumber of change.
+// If patchsetNumber is 0, the current patchset will be used.
+// change needs to contain all revisions and their commits.
+func (g GerritInstance) NewPatchsetCreatedMessage(change *ChangeInfo, patchsetNumber uint) (*Message, error) {
+	revision := ""
+	for sha, r := range change.Revisions {
+		if (patchsetNumber == 0 && sha == change.CurrentRevision) || (patchsetNumber > 0 && r.Number == patchsetNumber) {
+			revision = sha
+			break
+		}
 	}
 
-	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
-		log.Printf("> Change-details for change id \"%s\" received", changeID)
+	if len(revision) == 0 {
+		return nil, fmt.Errorf("Patchset %d not found in change %d", patchsetNumber, change.Number)
+	}
 
-	} else {
-		log.Printf("> Call success, but the status code doesn`t match ~200: %s", resp.Status)
-		return nil, errors.New("Call success, but the status code doesn`t match ~200")
+	m := &Message{
+		Type: "patchset-created",
+		Change: Change{
+			Project:       change.Project,
+			Branch:        change.Branch,
+			ID:            change.ChangeID,
+			Subject:       change.Subject,
+			CommitMessage: change.Revisions[revision].Commit.Message,
+			URL:           fmt.Sprintf("%s/%d", strings.TrimRight(g.URL, "/"), change.Number),
+			Private:       change.IsPrivate,
+		},
+		Patchset: Patchset{
+			Ref:      change.Revisions[revision].Ref,
+			Revision: revision,
+			Number:   change.Revisions[revision].Number,
+		},
 	}
 
-	var change ChangeInfo
+	return m, nil
+}
 
-	respBody, err := ioutil.ReadAll(resp.Body)
-	// Every Gerrit response starts with ")]}'"
-	jsonBody := string(respBody)[4:]
+// getChange requests the change with the id changeID.
+// options are the additional fields Gerrit should return.
+// @link https://review.typo3.org/Documentation/rest-api-changes.html#get-change
+func (g GerritInstance) getChange(ctx context.Context, changeID string, options ...string) (*ChangeInfo, error) {
+	params := url.Values{}
+	params["o"] = options
+	urlToCall := fmt.Sprintf("%s/changes/%s/?%s", g.getAPIUrl(false), changeID, params.Encode())
 
-	err = json.Unmarshal([]byte(jsonBody), &change)
-	if err != nil {
+	change := new(ChangeInfo)
+	if err := g.call(ctx, "GET", urlToCall, nil, change); err != nil {
 		return nil, err
 	}
+	log.Printf("> Change-details for change id \"%s\" received", changeID)
 
-	return &change, nil
+	return change, nil
 }
 
-// https://review.typo3.org/Documentation/rest-api-changes.html#set-review
-func (g GerritInstance) PostCommentOnChangeset(m *Message, vote int, msg string) {
-	log.Printf("> Start posting review for %s (%s)", m.Change.URL, m.Patchset.Ref)
+// ListFiles returns the files modified by the revision revisionID of the change changeID.
+// The keys are the paths of the files (including the magic file "/COMMIT_MSG").
+// @link https://review.typo3.org/Documentation/rest-api-changes.html#list-files
+func (g GerritInstance) ListFiles(ctx context.Context, changeID, revisionID string) (map[string]FileInfo, error) {
+	urlToCall := fmt.Sprintf("%s/changes/%s/revisions/%s/files/", g.getAPIUrl(false), changeID, revisionID)
 
-	changeID := m.Change.ID
-	revisionID := m.Patchset.Revision
-	urlToCall := fmt.Sprintf("%s/changes/%s/revisions/%s/review", g.getAPIUrl(true), changeID, revisionID)
+	var files map[string]FileInfo
+	if err := g.call(ctx, "GET", urlToCall, nil, &files); err != nil {
+		return nil, err
+	}
 
-	log.Printf("> Calling %s", urlToCall)
+	return files, nil
+}
 
-	bodyStruct := &ReviewInput{
+// PostCommentOnChangeset posts msg as comment and vote as "Verified" label on the patchset of m.
+func (g GerritInstance) PostCommentOnChangeset(ctx context.Context, m *Message, vote int, msg string) error {
+	return g.PostReview(ctx, m, &ReviewInput{
 		Message: msg,
 		Labels: map[string]int{
 			// Code-Review
 			"Verified": vote,
 		},
-	}
-
-	body, _ := json.Marshal(bodyStruct)
-
-	client := &http.Client{}
-	req, _ := http.NewRequest("POST", urlToCall, strings.NewReader(string(body)))
-	req.SetBasicAuth(g.Username, g.Password)
-	req.Header.Add("Content-Type", "application/json;charset=UTF-8")
+	})
+}
 
-	resp, err := client.Do(req)
-	defer resp.Body.Close()
+// PostReview posts the review (comment, labels and inline comments) on the patchset of m.
+// If a Reviewer is configured (e.g. SSH), it posts the review instead of the REST API.
+// https://review.typo3.org/Documentation/rest-api-changes.html#set-review
+func (g GerritInstance) PostReview(ctx context.Context, m *Message, review *ReviewInput) error {
+	log.Printf("> Start posting review for %s (%s)", m.Change.URL, m.Patchset.Ref)
 
+	var err error
+	if g.Reviewer != nil {
+		err = g.Reviewer.PostReview(ctx, m, review)
+	} else {
+		urlToCall := fmt.Sprintf("%s/changes/%s/revisions/%s/review", g.getAPIUrl(true), m.Change.ID, m.Patchset.Revision)
+		err = g.call(ctx, "POST", urlToCall, review, nil)
+	}
 	if err != nil {
-		log.Println("> Call failed", err)
+		return err
 	}
+	log.Printf("> Review posted for %s (%s)", m.Change.URL, m.Patchset.Ref)
 
-	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
-		log.Printf("> Call success: %s", resp.Status)
-	} else {
-		log.Printf("> Call success, but the status code doesn`t match ~200: %s", resp.Status)
-	}
+	return nil
 }
@@ -0,0 +1,81 @@
+package gerrit
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// States of a check of the Gerrit checks plugin.
+// @link https://gerrit.googlesource.com/plugins/checks/+/refs/heads/master/resources/Documentation/rest-api-checks.md#check-state
+const (
+	CheckStateNotStarted = "NOT_STARTED"
+	CheckStateScheduled  = "SCHEDULED"
+	CheckStateRunning    = "RUNNING"
+	CheckStateSuccessful = "SUCCESSFUL"
+	CheckStateFailed     = "FAILED"
+)
+
+// @link https://gerrit.googlesource.com/plugins/checks/+/refs/heads/master/resources/Documentation/rest-api-checkers.md#checker-input
+type CheckerInput struct {
+	UUID        string `json:"uuid"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	URL         string `json:"url,omitempty"`
+	Repository  string `json:"repository"`
+	Status      string `json:"status"`
+}
+
+// @link https://gerrit.googlesource.com/plugins/checks/+/refs/heads/master/resources/Documentation/rest-api-checkers.md#checker-info
+type CheckerInfo struct {
+	UUID       string `json:"uuid"`
+	Name       string `json:"name"`
+	Repository string `json:"repository"`
+	Status     string `json:"status"`
+}
+
+// @link https://gerrit.googlesource.com/plugins/checks/+/refs/heads/master/resources/Documentation/rest-api-checks.md#check-input
+type CheckInput struct {
+	CheckerUUID string     `json:"checker_uuid"`
+	State       string     `json:"state"`
+	Message     string     `json:"message,omitempty"`
+	URL         string     `json:"url,omitempty"`
+	Started     *Timestamp `json:"started,omitempty"`
+	Finished    *Timestamp `json:"finished,omitempty"`
+}
+
+// GetChecker returns the checker with the UUID uuid.
+// If the checker doesn`t exist, IsNotFound(err) is true.
+// @link https://gerrit.googlesource.com/plugins/checks/+/refs/heads/master/resources/Documentation/rest-api-checkers.md#get-checker
+func (g GerritInstance) GetChecker(ctx context.Context, uuid string) (*CheckerInfo, error) {
+	urlToCall := fmt.Sprintf("%s/plugins/checks/checkers/%s", g.getAPIUrl(true), url.PathEscape(uuid))
+
+	checker := new(CheckerInfo)
+	if err := g.call(ctx, "GET", urlToCall, nil, checker); err != nil {
+		return nil, err
+	}
+
+	return checker, nil
+}
+
+// CreateChecker registers a new checker.
+// @link https://gerrit.googlesource.com/plugins/checks/+/refs/heads/master/resources/Documentation/rest-api-checkers.md#create-checker
+func (g GerritInstance) CreateChecker(ctx context.Context, input *CheckerInput) error {
+	urlToCall := fmt.Sprintf("%s/plugins/checks/checkers/", g.getAPIUrl(true))
+
+	return g.call(ctx, "POST", urlToCall, input, nil)
+}
+
+// PostCheck creates or updates the check of the revision revisionID of the change changeID.
+// @link https://gerrit.googlesource.com/plugins/checks/+/refs/heads/master/resources/Documentation/rest-api-checks.md#create-check
+func (g GerritInstance) PostCheck(ctx context.Context, changeID, revisionID string, input *CheckInput) error {
+	urlToCall := fmt.Sprintf("%s/changes/%s/revisions/%s/checks/", g.getAPIUrl(true), changeID, revisionID)
+
+	return g.call(ctx, "POST", urlToCall, input, nil)
+}
+
+// NewTimestamp returns t as timestamp of the Gerrit REST API.
+func NewTimestamp(t time.Time) *Timestamp {
+	return &Timestamp{Time: t.UTC()}
+}
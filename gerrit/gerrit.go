@@ -1,28 +1,87 @@
 package gerrit
 
 import (
+	"encoding/json"
+	"github.com/andygrunwald/gotrap/backoff"
 	"github.com/andygrunwald/gotrap/config"
+	"net/http"
 	"strings"
+	"time"
 )
 
+// transport is shared by all Gerrit clients to reuse connections between jobs.
+var transport = &http.Transport{
+	Proxy:               http.ProxyFromEnvironment,
+	TLSHandshakeTimeout: 10 * time.Second,
+	IdleConnTimeout:     90 * time.Second,
+	MaxIdleConnsPerHost: 10,
+}
+
 type GerritInstance struct {
 	URL      string
-	Username string
-	Password string
 	Template string
+
+	// Auth adds the credentials to requests. Without Auth, requests are sent anonymously.
+	Auth Authenticator
+	// Anonymous disables the prefix "/a" of the authenticated REST API
+	Anonymous bool
+	// Reviewer posts the reviews. Without a reviewer, the REST API is used.
+	Reviewer Reviewer
+
+	// Client sends the requests. Without a client, http.DefaultClient is used.
+	Client *http.Client
+	// Retries is the number of retries for connection errors and server errors (5xx)
+	Retries int
+	Backoff backoff.Backoff
 }
 
 // https://review.typo3.org/Documentation/rest-api-changes.html#review-input
 type ReviewInput struct {
-	Message string         `json:"message"`
-	Labels  map[string]int `json:"labels"`
+	Message               string                         `json:"message"`
+	Labels                map[string]int                 `json:"labels,omitempty"`
+	Tag                   string                         `json:"tag,omitempty"`
+	Notify                string                         `json:"notify,omitempty"`
+	NotifyDetails         map[string]NotifyInfo          `json:"notify_details,omitempty"`
+	OmitDuplicateComments bool                           `json:"omit_duplicate_comments,omitempty"`
+	Comments              map[string][]CommentInput      `json:"comments,omitempty"`
+	RobotComments         map[string][]RobotCommentInput `json:"robot_comments,omitempty"`
+}
+
+// https://review.typo3.org/Documentation/rest-api-changes.html#notify-info
+type NotifyInfo struct {
+	Accounts []string `json:"accounts"`
+}
+
+// https://review.typo3.org/Documentation/rest-api-changes.html#comment-input
+type CommentInput struct {
+	Line       int    `json:"line,omitempty"`
+	Message    string `json:"message"`
+	Unresolved *bool  `json:"unresolved,omitempty"`
+}
+
+// https://review.typo3.org/Documentation/rest-api-changes.html#robot-comment-input
+type RobotCommentInput struct {
+	CommentInput
+	RobotID    string `json:"robot_id"`
+	RobotRunID string `json:"robot_run_id"`
+	URL        string `json:"url,omitempty"`
+}
+
+// https://review.typo3.org/Documentation/rest-api-changes.html#file-info
+type FileInfo struct {
+	Status        string `json:"status"`
+	Binary        bool   `json:"binary"`
+	OldPath       string `json:"old_path"`
+	LinesInserted int    `json:"lines_inserted"`
+	LinesDeleted  int    `json:"lines_deleted"`
 }
 
 // @link https://review.typo3.org/Documentation/json.html#patchSet
 type Patchset struct {
-	Ref      string `json:"ref"`
-	Revision string `json:"revision"`
-	Number   uint   `json:"number,string"`
+	Ref      string   `json:"ref"`
+	Revision string   `json:"revision"`
+	Number   uint     `json:"number,string"`
+	Uploader *Account `json:"uploader,omitempty"`
 }
 
 // @link https://review.typo3.org/Documentation/json.html#change
@@ -33,6 +92,22 @@ type Change struct {
 	Subject       string `json:"subject"`
 	CommitMessage string `json:"commitMessage"`
 	URL           string `json:"url"`
+	// Private is only part of the events of Gerrit 2.15 and newer
+	Private bool `json:"private"`
+}
+
+// @link https://review.typo3.org/Documentation/json.html#account
+type Account struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Username string `json:"username"`
+}
+
+// @link https://review.typo3.org/Documentation/json.html#approval
+type Approval struct {
+	Type     string `json:"type"`
+	Value    string `json:"value"`
+	OldValue string `json:"oldValue"`
 }
 
 // @link https://review.typo3.org/Documentation/cmd-stream-events.html#events
@@ -40,27 +115,146 @@ type Message struct {
 	Type     string   `json:"type"`
 	Change   Change   `json:"change"`
 	Patchset Patchset `json:"patchSet"`
+
+	// Author, Approvals and Comment are only part of "comment-added" messages
+	Author    *Account   `json:"author,omitempty"`
+	Approvals []Approval `json:"approvals,omitempty"`
+	Comment   string     `json:"comment,omitempty"`
+
+	// Details are requested from the REST API while the message is handled.
+	// They are nil until then.
+	Details *ChangeDetails `json:"-"`
 }
 
 // @link https://review.typo3.org/Documentation/rest-api-changes.html#change-info
 type ChangeInfo struct {
-	CurrentRevision string `json:"current_revision"`
+	Project         string               `json:"project"`
+	Branch          string               `json:"branch"`
+	Topic           string               `json:"topic"`
+	Hashtags        []string             `json:"hashtags"`
+	ChangeID        string               `json:"change_id"`
+	Subject         string               `json:"subject"`
+	Number          int                  `json:"_number"`
+	Owner           AccountInfo          `json:"owner"`
+	Created         Timestamp            `json:"created"`
+	Updated         Timestamp            `json:"updated"`
+	Insertions      int                  `json:"insertions"`
+	Deletions       int                  `json:"deletions"`
+	WorkInProgress  bool                 `json:"work_in_progress"`
+	IsPrivate       bool                 `json:"is_private"`
+	Labels          map[string]LabelInfo `json:"labels"`
+	Messages        []ChangeMessageInfo  `json:"messages"`
+	CurrentRevision string               `json:"current_revision"`
 	Revisions       map[string]RevisionInfo
 	Status          string `json:"status"`
+	MoreChanges     bool   `json:"_more_changes"`
+}
+
+// @link https://review.typo3.org/Documentation/rest-api-accounts.html#account-info
+type AccountInfo struct {
+	AccountID int    `json:"_account_id"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	Username  string `json:"username"`
+}
+
+// @link https://review.typo3.org/Documentation/rest-api-changes.html#label-info
+type LabelInfo struct {
+	Approved    *AccountInfo   `json:"approved"`
+	Rejected    *AccountInfo   `json:"rejected"`
+	Recommended *AccountInfo   `json:"recommended"`
+	Disliked    *AccountInfo   `json:"disliked"`
+	Blocking    bool           `json:"blocking"`
+	All         []ApprovalInfo `json:"all"`
+}
+
+// @link https://review.typo3.org/Documentation/rest-api-changes.html#approval-info
+type ApprovalInfo struct {
+	AccountInfo
+	Value int `json:"value"`
+}
+
+// @link https://review.typo3.org/Documentation/rest-api-changes.html#change-message-info
+type ChangeMessageInfo struct {
+	ID             string       `json:"id"`
+	Author         *AccountInfo `json:"author"`
+	Message        string       `json:"message"`
+	Tag            string       `json:"tag"`
+	RevisionNumber uint         `json:"_revision_number"`
 }
 
 // @link https://review.typo3.org/Documentation/rest-api-changes.html#revision-info
 type RevisionInfo struct {
-	Number uint `json:"_number"`
+	Number   uint                `json:"_number"`
+	Ref      string              `json:"ref"`
+	Created  Timestamp           `json:"created"`
+	Uploader AccountInfo         `json:"uploader"`
+	Commit   CommitInfo          `json:"commit"`
+	Files    map[string]FileInfo `json:"files"`
+}
+
+// @link https://review.typo3.org/Documentation/rest-api-changes.html#commit-info
+type CommitInfo struct {
+	Commit  string       `json:"commit"`
+	Parents []CommitInfo `json:"parents"`
+	Subject string       `json:"subject"`
+	Message string       `json:"message"`
+}
+
+// @link https://review.typo3.org/Documentation/rest-api-changes.html#related-change-and-commit-info
+type RelatedChangeAndCommitInfo struct {
+	Project               string     `json:"project"`
+	ChangeID              string     `json:"change_id"`
+	Commit                CommitInfo `json:"commit"`
+	Number                int        `json:"_change_number"`
+	RevisionNumber        int        `json:"_revision_number"`
+	CurrentRevisionNumber int        `json:"_current_revision_number"`
+	Status                string     `json:"status"`
+}
+
+// Timestamp is a timestamp of the Gerrit REST API (UTC, e.g. "2013-02-01 09:59:32.126000000").
+// @link https://review.typo3.org/Documentation/rest-api.html#timestamp
+type Timestamp struct {
+	time.Time
+}
+
+const timestampLayout = "2006-01-02 15:04:05.999999999"
+
+func (t *Timestamp) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseInLocation(timestampLayout, s, time.UTC)
+	if err != nil {
+		return err
+	}
+	t.Time = parsed
+
+	return nil
+}
+
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.UTC().Format("2006-01-02 15:04:05.000000000"))
 }
 
 // NewGerritInstance returns a new Gerrit instance
 func NewGerritClient(c *config.GerritConfiguration) *GerritInstance {
 	gerrit := &GerritInstance{
-		URL:      c.URL,
-		Username: c.Username,
-		Password: c.Password,
-		Template: strings.Join(c.Comment, "\n"),
+		URL:       c.URL,
+		Template:  c.Comment.String(),
+		Auth:      NewAuthenticator(c),
+		Anonymous: c.Auth.Type == "none",
+		Client: &http.Client{
+			Transport: transport,
+			Timeout:   time.Duration(c.Timeout) * time.Second,
+		},
+		Retries: c.Retries,
+		Backoff: backoff.Default,
+	}
+	if c.SSH.Enabled {
+		gerrit.Reviewer = NewSSHReviewer(c)
 	}
 
 	return gerrit
@@ -69,7 +263,7 @@ func NewGerritClient(c *config.GerritConfiguration) *GerritInstance {
 func (g GerritInstance) getAPIUrl(authRequired bool) string {
 	host := strings.TrimRight(g.URL, "/")
 
-	if authRequired == true {
+	if authRequired == true && !g.Anonymous {
 		host += "/a"
 	}
 
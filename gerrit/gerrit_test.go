@@ -1,8 +1,15 @@
 package gerrit
 
 import (
+	"context"
+	"fmt"
+	"github.com/andygrunwald/gotrap/backoff"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestGetAPIUrlIsNotEmpty(t *testing.T) {
@@ -24,3 +31,112 @@ func TestGetAPIUrlContainsAuthPrefix(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestQueryChangesRequestsAllPages(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if q := r.URL.Query().Get("q"); q != "status:open project:X" {
+			t.Errorf("Unexpected query %q", q)
+		}
+
+		fmt.Fprint(w, ")]}'\n")
+		if r.URL.Query().Get("S") == "2" {
+			fmt.Fprint(w, `[{"_number": 3, "revisions": {"ccc": {"_number": 1, "created": "2017-03-01 12:00:00.000000000"}}}]`)
+			return
+		}
+		fmt.Fprint(w, `[{"_number": 1}, {"_number": 2, "_more_changes": true}]`)
+	}))
+	defer ts.Close()
+
+	g := &GerritInstance{URL: ts.URL}
+	changes, err := g.QueryChanges(context.Background(), "status:open project:X", "CURRENT_REVISION")
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if len(changes) != 3 || changes[2].Number != 3 {
+		t.Fatalf("Expected 3 changes, got %v", changes)
+	}
+	if created := changes[2].Revisions["ccc"].Created; created.Year() != 2017 || created.Location() != time.UTC {
+		t.Errorf("Unexpected creation time %s", created)
+	}
+}
+
+func TestCallRetriesServerErrors(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"_number": 36909, "status": "NEW"}`)
+	}))
+	defer ts.Close()
+
+	g := &GerritInstance{URL: ts.URL, Retries: 3, Backoff: backoff.Backoff{Initial: time.Millisecond, Max: time.Millisecond, Multiplier: 1}}
+	change, err := g.GetChangeInformation(context.Background(), "36909")
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	// Responses without the XSSI prefix are accepted as well
+	if calls != 3 || change.Number != 36909 {
+		t.Errorf("Expected change 36909 after 3 calls, got %d after %d calls", change.Number, calls)
+	}
+}
+
+func TestCallReturnsClientErrorsWithoutRetry(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+
+	g := &GerritInstance{URL: ts.URL, Retries: 3}
+	err := g.PostCommentOnChangeset(context.Background(), &Message{}, -1, "Tests failed")
+	if !IsNotFound(err) || calls != 1 {
+		t.Errorf("Expected a 404 error after one call, got %v after %d calls", err, calls)
+	}
+}
+
+func TestCallDoesNotRetryPostRequests(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer ts.Close()
+
+	// The review may have been posted, even if the answer got lost
+	g := &GerritInstance{URL: ts.URL, Retries: 3, Backoff: backoff.Backoff{Initial: time.Millisecond, Max: time.Millisecond, Multiplier: 1}}
+	if err := g.PostCommentOnChangeset(context.Background(), &Message{}, 1, "Tests passed"); err == nil || calls != 1 {
+		t.Errorf("Expected an error after one call, got %v after %d calls", err, calls)
+	}
+}
+
+func TestCallRetriesPostRequestsWhichWereNotSent(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Close()
+
+	attempts := 0
+	g := &GerritInstance{URL: ts.URL, Retries: 2, Backoff: backoff.Backoff{Initial: time.Millisecond, Max: time.Millisecond, Multiplier: 1}}
+	g.Client = &http.Client{Transport: &http.Transport{
+		Dial: func(network, addr string) (net.Conn, error) {
+			attempts++
+			return net.Dial(network, addr)
+		},
+	}}
+	if err := g.PostCommentOnChangeset(context.Background(), &Message{}, 1, "Tests passed"); err == nil || attempts != 3 {
+		t.Errorf("Expected an error after 3 attempts, got %v after %d attempts", err, attempts)
+	}
+}
+
+func TestCallReturnsConnectionErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Close()
+
+	g := &GerritInstance{URL: ts.URL}
+	if _, err := g.GetChangeInformation(context.Background(), "36909"); err == nil {
+		t.Error("Expected an error, got nil")
+	}
+}
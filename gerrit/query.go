@@ -0,0 +1,46 @@
+package gerrit
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// QueryChanges returns all changes matching query (e.g. "status:open project:X").
+// options are the additional fields Gerrit should return.
+// Gerrit limits the number of results per request, so all pages are requested.
+// @link https://review.typo3.org/Documentation/rest-api-changes.html#list-changes
+func (g GerritInstance) QueryChanges(ctx context.Context, query string, options ...string) ([]ChangeInfo, error) {
+	var changes []ChangeInfo
+
+	for {
+		page, err := g.queryChanges(ctx, query, len(changes), options)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, page...)
+
+		if len(page) == 0 || !page[len(page)-1].MoreChanges {
+			return changes, nil
+		}
+	}
+}
+
+// queryChanges requests a single page of changes, skipping the first start results.
+func (g GerritInstance) queryChanges(ctx context.Context, query string, start int, options []string) ([]ChangeInfo, error) {
+	params := url.Values{}
+	params.Set("q", query)
+	params["o"] = options
+	if start > 0 {
+		params.Set("S", fmt.Sprintf("%d", start))
+	}
+
+	urlToCall := fmt.Sprintf("%s/changes/?%s", g.getAPIUrl(false), params.Encode())
+
+	var changes []ChangeInfo
+	if err := g.call(ctx, "GET", urlToCall, nil, &changes); err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
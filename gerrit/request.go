@@ -0,0 +1,172 @@
+package gerrit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// xssiPrefix is prepended to every JSON response of Gerrit to prevent XSSI attacks.
+// @link https://review.typo3.org/Documentation/rest-api.html#output
+var xssiPrefix = []byte(")]}'")
+
+// HTTPError is returned if Gerrit answers with a status code other than 2xx.
+type HTTPError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("Gerrit answered with %s", e.Status)
+}
+
+// IsNotFound returns true if err is a 404 answer of Gerrit.
+func IsNotFound(err error) bool {
+	httpErr, ok := err.(*HTTPError)
+	return ok && httpErr.StatusCode == http.StatusNotFound
+}
+
+// call sends a request with the JSON encoded input (if not nil) to urlToCall
+// and decodes the answer into output (if not nil).
+// Connection errors and server errors (5xx) of GET requests are retried up to g.Retries times with a backoff.
+// Other requests (e.g. posting a review) are not idempotent. They are only retried
+// if the connection to Gerrit couldn't be established, so Gerrit never received them.
+// All other errors and a canceled ctx return immediately.
+func (g GerritInstance) call(ctx context.Context, method, urlToCall string, input, output interface{}) error {
+	var body []byte
+	if input != nil {
+		var err error
+		body, err = json.Marshal(input)
+		if err != nil {
+			return err
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		retry, err := g.do(ctx, method, urlToCall, body, output)
+		if method != http.MethodGet && !notSent(err) {
+			retry = false
+		}
+		if err == nil || !retry || attempt >= g.Retries {
+			return err
+		}
+
+		delay := g.Backoff.Duration(attempt)
+		log.Printf("> Calling %s failed (attempt %d): %s. Next try in %s", urlToCall, attempt+1, err, delay)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// do sends a single request.
+// It returns if the request can be retried in case of an error.
+// Errors during building the request (e.g. an unreadable cookie file) can`t be fixed by a retry.
+func (g GerritInstance) do(ctx context.Context, method, urlToCall string, body []byte, output interface{}) (bool, error) {
+	log.Printf("> Calling %s %s\n", method, urlToCall)
+
+	req, err := g.newRequest(ctx, method, urlToCall, body)
+	if err != nil {
+		return false, err
+	}
+	resp, err := g.client().Do(req)
+	// Digest auth needs the challenge of Gerrit first
+	if err == nil && resp.StatusCode == http.StatusUnauthorized {
+		if c, ok := g.Auth.(challenger); ok && c.Challenge(resp) {
+			resp.Body.Close()
+			if req, err = g.newRequest(ctx, method, urlToCall, body); err != nil {
+				return false, err
+			}
+			resp, err = g.client().Do(req)
+		}
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode >= 500, &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	if output == nil {
+		return false, nil
+	}
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return true, err
+	}
+
+	return false, decodeResponse(respBody, output)
+}
+
+// newRequest builds the request and adds the credentials.
+func (g GerritInstance) newRequest(ctx context.Context, method, urlToCall string, body []byte) (*http.Request, error) {
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, urlToCall, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if g.Auth != nil {
+		if err := g.Auth.Authenticate(req); err != nil {
+			return nil, err
+		}
+	}
+	if body != nil {
+		req.Header.Add("Content-Type", "application/json;charset=UTF-8")
+	}
+
+	return req, nil
+}
+
+// client returns the configured HTTP client or the default client.
+func (g GerritInstance) client() *http.Client {
+	if g.Client != nil {
+		return g.Client
+	}
+
+	return http.DefaultClient
+}
+
+// notSent returns true if err occurred while connecting to Gerrit,
+// before the request was sent.
+func notSent(err error) bool {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	opErr, ok := err.(*net.OpError)
+
+	return ok && opErr.Op == "dial"
+}
+
+// decodeResponse removes the XSSI prefix of a Gerrit response (if present)
+// and decodes the JSON into output.
+func decodeResponse(respBody []byte, output interface{}) error {
+	jsonBody := bytes.TrimPrefix(respBody, xssiPrefix)
+
+	if err := json.Unmarshal(jsonBody, output); err != nil {
+		return fmt.Errorf("Gerrit answered with an invalid response: %s", err)
+	}
+
+	return nil
+}
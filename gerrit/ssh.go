@@ -0,0 +1,114 @@
+package gerrit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/andygrunwald/gotrap/config"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Reviewer posts reviews on patchsets.
+// It replaces the REST API for posting reviews, e.g. for Gerrit hosts
+// which only offer an anonymous REST API (see SSHReviewer).
+type Reviewer interface {
+	PostReview(ctx context.Context, m *Message, review *ReviewInput) error
+}
+
+// SSHReviewer posts reviews with the SSH command "gerrit review".
+// The review is passed as JSON, so comments, labels, tags and notify settings work like with the REST API.
+// @link https://review.typo3.org/Documentation/cmd-review.html
+type SSHReviewer struct {
+	// Command is the ssh binary, e.g. "ssh"
+	Command  string
+	Host     string
+	Port     int
+	Username string
+	KeyFile  string
+	// Options are additional arguments for Command, e.g. ["-o", "StrictHostKeyChecking=yes"]
+	Options []string
+}
+
+// NewSSHReviewer returns a reviewer for gerrit.ssh.
+// Without a host, the host of gerrit.url is used.
+func NewSSHReviewer(c *config.GerritConfiguration) *SSHReviewer {
+	host := c.SSH.Host
+	if len(host) == 0 {
+		if u, err := url.Parse(c.URL); err == nil {
+			host = u.Hostname()
+		}
+	}
+
+	return &SSHReviewer{
+		Command:  c.SSH.Command,
+		Host:     host,
+		Port:     c.SSH.Port,
+		Username: c.SSH.Username,
+		KeyFile:  c.SSH.KeyFile,
+		Options:  c.SSH.Options,
+	}
+}
+
+// PostReview posts the review on the patchset of m.
+// Project and branch are passed as well, because a revision can be part of several changes.
+func (s *SSHReviewer) PostReview(ctx context.Context, m *Message, review *ReviewInput) error {
+	input, err := json.Marshal(review)
+	if err != nil {
+		return err
+	}
+
+	return s.run(ctx, input, "gerrit", "review", "--json", "--project", sshQuote(m.Change.Project), "--branch", sshQuote(m.Change.Branch), m.Patchset.Revision)
+}
+
+// VerifyCredentials checks if Gerrit accepts the SSH key by requesting the version of Gerrit.
+func (s *SSHReviewer) VerifyCredentials() error {
+	return s.run(context.Background(), nil, "gerrit", "version")
+}
+
+// run executes command on the Gerrit host with stdin as input.
+// The output of ssh on stderr is part of the error.
+func (s *SSHReviewer) run(ctx context.Context, stdin []byte, command ...string) error {
+	cmd := exec.CommandContext(ctx, s.Command, s.args(command...)...)
+	cmd.Stdin = bytes.NewReader(stdin)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if output := strings.TrimSpace(stderr.String()); len(output) > 0 {
+			return fmt.Errorf("%s: %s", err, output)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// args returns the arguments for Command to execute command on the Gerrit host.
+// BatchMode prevents ssh from asking for a password or passphrase.
+func (s *SSHReviewer) args(command ...string) []string {
+	args := []string{"-p", strconv.Itoa(s.Port), "-o", "BatchMode=yes"}
+	if len(s.KeyFile) > 0 {
+		args = append(args, "-i", s.KeyFile)
+	}
+	args = append(args, s.Options...)
+
+	target := s.Host
+	if len(s.Username) > 0 {
+		target = s.Username + "@" + s.Host
+	}
+	args = append(args, target)
+
+	return append(args, command...)
+}
+
+// sshQuote quotes an argument of a Gerrit SSH command.
+// ssh joins all arguments with spaces, so Gerrit would split values containing spaces otherwise.
+// Single quotes within s end the quoting, are escaped and start a new quoting.
+func sshQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
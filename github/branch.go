@@ -10,10 +10,8 @@ import (
 // It is important that the branch exists at Github, because otherwise
 // we won`t be able to create the merge request.
 // Attention: This call is "kind of" blocking.
-// It contains a for loop which ends only if the branch exists.
-func (c GithubClient) waitUntilBranchisSynced(branchName string) error {
-	ctx := context.Background()
-
+// It contains a for loop which ends only if the branch exists or ctx is canceled.
+func (c GithubClient) waitUntilBranchisSynced(ctx context.Context, branchName string) error {
 	// Loop until branch is found on github and synced by Gerrit
 	for {
 		branch, _, err := c.Client.Repositories.GetBranch(ctx, c.Conf.Organisation, c.Conf.Repository, branchName)
@@ -30,7 +28,9 @@ func (c GithubClient) waitUntilBranchisSynced(branchName string) error {
 			break
 		}
 
-		time.Sleep(time.Duration(c.Conf.BranchPollingIntervall) * time.Second)
+		if err := sleep(ctx, time.Duration(c.Conf.BranchPollingIntervall)*time.Second); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -0,0 +1,123 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/google/go-github/github"
+)
+
+// mediaTypeChecks is needed for the Checks API of Github.
+const mediaTypeChecks = "application/vnd.github.antiope-preview+json"
+
+// Annotation is a problem a check run reported for a line of a file,
+// like a lint error or the location of a failing test.
+type Annotation struct {
+	CheckRunID   int64
+	CheckRunName string
+	CheckRunURL  string
+
+	Path      string
+	StartLine int
+	EndLine   int
+	Level     string
+	Title     string
+	Message   string
+}
+
+// checkRunAnnotation is an annotation as returned by the Checks API.
+// The field names changed during the preview of the Checks API (filename -> path,
+// warning_level -> annotation_level). Both variants are supported.
+type checkRunAnnotation struct {
+	Path            string `json:"path"`
+	FileName        string `json:"filename"`
+	StartLine       int    `json:"start_line"`
+	EndLine         int    `json:"end_line"`
+	AnnotationLevel string `json:"annotation_level"`
+	WarningLevel    string `json:"warning_level"`
+	Title           string `json:"title"`
+	Message         string `json:"message"`
+}
+
+// ListAnnotations returns the annotations of all check runs of the head commit of pr.
+func (c GithubClient) ListAnnotations(ctx context.Context, pr github.PullRequest) ([]Annotation, error) {
+	var annotations []Annotation
+
+	opt := &github.ListCheckRunsOptions{
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		runs, resp, err := c.Client.Checks.ListCheckRunsForRef(ctx, c.Conf.Organisation, c.Conf.Repository, pr.Head.GetSHA(), opt)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, run := range runs.CheckRuns {
+			if run.Output == nil || run.Output.GetAnnotationsCount() == 0 {
+				continue
+			}
+
+			runAnnotations, err := c.listCheckRunAnnotations(ctx, run)
+			if err != nil {
+				return nil, err
+			}
+			annotations = append(annotations, runAnnotations...)
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	log.Printf("> %d annotations found for %v/%v -> %v", len(annotations), c.Conf.Organisation, c.Conf.Repository, pr.Head.GetSHA())
+
+	return annotations, nil
+}
+
+// listCheckRunAnnotations requests all annotations of the check run run.
+func (c GithubClient) listCheckRunAnnotations(ctx context.Context, run *github.CheckRun) ([]Annotation, error) {
+	var annotations []Annotation
+
+	page := 1
+	for page != 0 {
+		u := fmt.Sprintf("repos/%v/%v/check-runs/%v/annotations?per_page=100&page=%d", c.Conf.Organisation, c.Conf.Repository, run.GetID(), page)
+		req, err := c.Client.NewRequest("GET", u, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", mediaTypeChecks)
+
+		var result []checkRunAnnotation
+		resp, err := c.Client.Do(ctx, req, &result)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, a := range result {
+			annotation := Annotation{
+				CheckRunID:   run.GetID(),
+				CheckRunName: run.GetName(),
+				CheckRunURL:  run.GetHTMLURL(),
+				Path:         a.Path,
+				StartLine:    a.StartLine,
+				EndLine:      a.EndLine,
+				Level:        a.AnnotationLevel,
+				Title:        a.Title,
+				Message:      a.Message,
+			}
+			if len(annotation.Path) == 0 {
+				annotation.Path = a.FileName
+			}
+			if len(annotation.Level) == 0 {
+				annotation.Level = a.WarningLevel
+			}
+			annotations = append(annotations, annotation)
+		}
+
+		page = resp.NextPage
+	}
+
+	return annotations, nil
+}
@@ -9,15 +9,19 @@ import (
 )
 
 // waitUntilCommitStatusIsAvailable checks if an external service (like TravisCI)
-// already finished the process and reports back via the Github Commit Status API
-func (c GithubClient) WaitUntilCommitStatusIsAvailable(pr github.PullRequest) (*github.CombinedStatus, error) {
+// already finished the process and reports back via the Github Commit Status API.
+// If ctx is canceled before, the error of ctx will be returned.
+// onStatus (if not nil) is called with every fetched status, including the pending ones.
+// This way, transitions of single contexts can be reported while waiting.
+func (c GithubClient) WaitUntilCommitStatusIsAvailable(ctx context.Context, pr github.PullRequest, onStatus func(*github.CombinedStatus)) (*github.CombinedStatus, error) {
 	s := new(github.CombinedStatus)
 	var err error
 
 	// Wait one round before we start polling,
 	// because in most cases the external service isn`t so fast
-	time.Sleep(time.Duration(c.Conf.StatusPollingIntervall) * time.Second)
-	ctx := context.Background()
+	if err := sleep(ctx, time.Duration(c.Conf.StatusPollingIntervall)*time.Second); err != nil {
+		return nil, err
+	}
 
 Loop:
 	for {
@@ -25,10 +29,19 @@ Loop:
 		s, _, err = c.Client.Repositories.GetCombinedStatus(ctx, c.Conf.Organisation, c.Conf.Repository, *pr.Head.Ref, nil)
 
 		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
 			log.Printf("> Error during status fetch: %v\n", err)
+			if err := sleep(ctx, time.Duration(c.Conf.StatusPollingIntervall)*time.Second); err != nil {
+				return nil, err
+			}
 
 		} else {
 			log.Printf("> Commit status for %v/%v -> %v: %s", c.Conf.Organisation, c.Conf.Repository, *pr.Head.Ref, *s.State)
+			if onStatus != nil {
+				onStatus(s)
+			}
 			switch *s.State {
 			// Success if the latest status for all contexts is success
 			case "success":
@@ -36,7 +49,9 @@ Loop:
 
 			// Pending if there are no statuses or a context is pending
 			case "pending":
-				time.Sleep(time.Duration(c.Conf.StatusPollingIntervall) * time.Second)
+				if err := sleep(ctx, time.Duration(c.Conf.StatusPollingIntervall)*time.Second); err != nil {
+					return nil, err
+				}
 
 			// Failure if any of the contexts report as error or failure
 			case "error":
@@ -3,6 +3,9 @@
 package github
 
 import (
+	"context"
+	"time"
+
 	"github.com/andygrunwald/gotrap/config"
 	"github.com/google/go-github/github"
 	"golang.org/x/oauth2"
@@ -16,11 +19,6 @@ type GithubClient struct {
 	Conf   *config.GithubConfiguration
 }
 
-type PullRequest struct {
-	PullRequest    *github.PullRequest
-	CombinedStatus *github.CombinedStatus
-}
-
 // tokenSource is an oauth2.TokenSource which returns a static access token
 type tokenSource struct {
 	token *oauth2.Token
@@ -46,3 +44,27 @@ func NewGithubClient(conf *config.GithubConfiguration) *GithubClient {
 
 	return client
 }
+
+// sleep pauses the current go routine for d.
+// It returns early with the error of ctx if ctx is canceled in the meantime.
+func sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// VerifyCredentials checks if the configured API token is accepted by Github
+// and has access to the configured repository.
+// It only reads the repository.
+func (c GithubClient) VerifyCredentials() error {
+	_, resp, err := c.Client.Repositories.Get(context.Background(), c.Conf.Organisation, c.Conf.Repository)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return nil
+}
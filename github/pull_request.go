@@ -3,17 +3,18 @@ package github
 import (
 	"bytes"
 	"context"
-	"errors"
 	"strings"
 	"text/template"
 
 	"github.com/andygrunwald/gotrap/gerrit"
+	"github.com/andygrunwald/gotrap/view"
 	"github.com/google/go-github/github"
 )
 
 // createPullRequestForPatchset will create a new Pull Request at Github
-// All information (like base and target branch) are received by the message by Gerrit
-func (c GithubClient) CreatePullRequestForPatchset(m *gerrit.Message) (*github.PullRequest, error) {
+// All information (like base and target branch) are received by the message by Gerrit.
+// Waiting for the branch can be aborted by canceling ctx.
+func (c GithubClient) CreatePullRequestForPatchset(ctx context.Context, m *gerrit.Message) (*github.PullRequest, error) {
 
 	// Remove "refs/" from the patchset reference,
 	// because if this patchset is synced to Github
@@ -25,30 +26,15 @@ func (c GithubClient) CreatePullRequestForPatchset(m *gerrit.Message) (*github.P
 
 	// Start polling until the branch is synced
 	// We have to wait, because after this we are able to continue
-	err := c.waitUntilBranchisSynced(baseRef)
-
-	if err != nil {
-		return nil, errors.New("Max loop reached for branch")
-	}
-
-	// Build title for Pull Request
-	titleBuffer := new(bytes.Buffer)
-	var titleTemplate = template.Must(template.New("pull-request-title").Parse(c.Conf.PRTemplate.Title))
-	err = titleTemplate.Execute(titleBuffer, m)
+	err := c.waitUntilBranchisSynced(ctx, baseRef)
 	if err != nil {
 		return nil, err
 	}
-	title := titleBuffer.String()
 
-	// Build body for Pull Request
-	bodyString := strings.Join(c.Conf.PRTemplate.Body, "\n")
-	bodyBuffer := new(bytes.Buffer)
-	var bodyTemplate = template.Must(template.New("pull-request-body").Parse(bodyString))
-	err = bodyTemplate.Execute(bodyBuffer, m)
+	title, body, err := c.RenderPullRequest(m)
 	if err != nil {
 		return nil, err
 	}
-	body := bodyBuffer.String()
 
 	// Create the pull request itself
 	pr := &github.NewPullRequest{
@@ -57,7 +43,6 @@ func (c GithubClient) CreatePullRequestForPatchset(m *gerrit.Message) (*github.P
 		Base:  &m.Change.Branch,
 		Body:  &body,
 	}
-	ctx := context.Background()
 	prResult, resp, err := c.Client.PullRequests.Create(ctx, c.Conf.Organisation, c.Conf.Repository, pr)
 	if err != nil {
 		return nil, err
@@ -67,6 +52,32 @@ func (c GithubClient) CreatePullRequestForPatchset(m *gerrit.Message) (*github.P
 	return prResult, nil
 }
 
+// RenderPullRequest renders the title and body of the pull request for the message m
+// based on the pull request templates of the configuration.
+// The templates have access to view.Message.
+func (c GithubClient) RenderPullRequest(m *gerrit.Message) (string, string, error) {
+	data := view.NewMessage(*m)
+
+	// Build title for Pull Request
+	titleBuffer := new(bytes.Buffer)
+	var titleTemplate = template.Must(template.New("pull-request-title").Parse(c.Conf.PRTemplate.Title))
+	err := titleTemplate.Execute(titleBuffer, data)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Build body for Pull Request
+	bodyString := c.Conf.PRTemplate.Body.String()
+	bodyBuffer := new(bytes.Buffer)
+	var bodyTemplate = template.Must(template.New("pull-request-body").Parse(bodyString))
+	err = bodyTemplate.Execute(bodyBuffer, data)
+	if err != nil {
+		return "", "", err
+	}
+
+	return titleBuffer.String(), bodyBuffer.String(), nil
+}
+
 func (c GithubClient) AddCommentToPullRequest(pr *github.PullRequest, message string) (bool, error) {
 	comment := &github.IssueComment{
 		Body: &message,
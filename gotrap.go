@@ -5,7 +5,11 @@ import (
 	"flag"
 	"fmt"
 	"github.com/andygrunwald/gotrap/config"
+	"github.com/andygrunwald/gotrap/gerrit"
+	"github.com/andygrunwald/gotrap/job"
+	"github.com/andygrunwald/gotrap/redact"
 	"github.com/andygrunwald/gotrap/stream"
+	"github.com/andygrunwald/gotrap/web"
 	"io/ioutil"
 	"log"
 	"os"
@@ -16,8 +20,18 @@ var (
 	flagConfigFile *string
 	flagPidFile    *string
 	flagVersion    *bool
+	flagDryRun     *bool
+
+	// logRedactor removes all configured secrets from the log output
+	logRedactor = redact.NewWriter(os.Stderr)
 )
 
+// secrets returns the credentials of c, including the cookies of the Gerrit cookie file.
+// Cookies which are replaced later (e.g. by git-cookie-authdaemon) are added on the next reload.
+func secrets(c *config.Configuration) []string {
+	return append(c.Secrets(), gerrit.CookieFileSecrets(c.Gerrit.Auth.CookieFile)...)
+}
+
 const (
 	majorVersion = 1
 	minorVersion = 0
@@ -28,10 +42,23 @@ func init() {
 	flagConfigFile = flag.String("config", "", "Path to configuration file.")
 	flagPidFile = flag.String("pidfile", "", "Write the process id into a given file.")
 	flagVersion = flag.Bool("version", false, "Outputs the version number and exits.")
+	flagDryRun = flag.Bool("dry-run", false, "Evaluate all incoming changes, but never write to Gerrit or Github.")
 }
 
 // main is the heart of gotrap.
 func main() {
+	log.SetOutput(logRedactor)
+
+	// Subcommands
+	if len(os.Args) > 1 && os.Args[1] == "run" {
+		runCommand(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 2 && os.Args[1] == "config" && os.Args[2] == "validate" {
+		validateCommand(os.Args[3:])
+		return
+	}
+
 	flag.Parse()
 
 	// Output the version and exit
@@ -59,14 +86,39 @@ func main() {
 	if err != nil {
 		log.Fatal("Configuration initialisation failed:", err)
 	}
+	logRedactor.SetSecrets(secrets(config)...)
+	if err := config.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if *flagDryRun {
+		config.Gotrap.DryRun = true
+	}
+	if config.Gotrap.DryRun {
+		log.Println("Dry-run mode: Nothing will be written to Gerrit or Github.")
+	}
+
+	// Registry of all jobs gotrap is working on
+	jobs := job.NewRegistry(config.Web.History)
+
+	// Bootstrap HTTP server
+	if len(config.Web.Listen) > 0 {
+		server := web.NewServer(&config.Web, jobs)
+		go func() {
+			if err := server.ListenAndServe(); err != nil {
+				log.Fatal("HTTP server failed:", err)
+			}
+		}()
+	}
 
 	// Bootstrap stream
-	stream, err := stream.GetStream(stream.StreamAmqp)
+	stream, err := stream.GetStream(stream.StreamTypes[config.Gotrap.Stream])
 	if err != nil {
 		log.Fatal("Stream initialisation failed:", err)
 	}
 
-	stream.Initialize(config)
+	stream.Initialize(config, jobs)
+	reloadOnSignal(flagConfigFile, config.Gotrap.Stream, stream)
+
 	err = stream.Start()
 	if err != nil {
 		log.Fatal("Stream start failed:", err)
@@ -0,0 +1,263 @@
+// Package job keeps track of the changes gotrap is working on.
+// Every incoming patchset becomes a job, which can be inspected and
+// controlled (e.g. canceled) while it is running.
+package job
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/andygrunwald/gotrap/gerrit"
+)
+
+// Phase describes the step a job is currently in.
+type Phase string
+
+const (
+	PhaseQueued           Phase = "queued"
+	PhaseChecking         Phase = "checking"
+	PhaseWaitingForBranch Phase = "waiting-for-branch"
+	PhaseWaitingForStatus Phase = "waiting-for-status"
+	PhaseReporting        Phase = "reporting"
+	PhaseFinished         Phase = "finished"
+)
+
+// Job is a single patchset handled by gotrap.
+// All methods are safe for concurrent use.
+type Job struct {
+	mu sync.Mutex
+
+	id             int64
+	message        gerrit.Message
+	phase          Phase
+	pullRequestURL string
+	queuedAt       time.Time
+	startedAt      time.Time
+	finishedAt     time.Time
+	vote           *int
+	result         string
+	statuses       []Status
+	hidden         bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	forced        bool
+	forcedVote    int
+	forcedMessage string
+}
+
+// Info is a snapshot of a job.
+// It is used to expose jobs to the outside world (e.g. via the HTTP API).
+type Info struct {
+	ID             int64      `json:"id"`
+	Project        string     `json:"project"`
+	Branch         string     `json:"branch"`
+	Change         string     `json:"change"`
+	ChangeURL      string     `json:"change-url"`
+	Subject        string     `json:"subject"`
+	Patchset       uint       `json:"patchset"`
+	Ref            string     `json:"ref"`
+	Phase          Phase      `json:"phase"`
+	PullRequestURL string     `json:"pull-request-url,omitempty"`
+	QueuedAt       time.Time  `json:"queued-at"`
+	StartedAt      *time.Time `json:"started-at,omitempty"`
+	FinishedAt     *time.Time `json:"finished-at,omitempty"`
+	Vote           *int       `json:"vote,omitempty"`
+	Result         string     `json:"result,omitempty"`
+	Statuses       []Status   `json:"statuses,omitempty"`
+}
+
+// Status is the state of a single context (e.g. "continuous-integration/travis-ci/pr")
+// reported to the Github Commit Status API.
+type Status struct {
+	Context     string `json:"context"`
+	State       string `json:"state"`
+	Description string `json:"description,omitempty"`
+	TargetURL   string `json:"target-url,omitempty"`
+}
+
+// Duration returns how long the job was running.
+// For jobs which are still running, the duration until now is returned.
+// Jobs which never started have no duration.
+func (i Info) Duration() time.Duration {
+	if i.StartedAt == nil {
+		return 0
+	}
+	if i.FinishedAt == nil {
+		return time.Since(*i.StartedAt)
+	}
+
+	return i.FinishedAt.Sub(*i.StartedAt)
+}
+
+func newJob(id int64, m gerrit.Message) *Job {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Job{
+		id:       id,
+		message:  m,
+		phase:    PhaseQueued,
+		queuedAt: time.Now(),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// ID returns the unique identifier of the job.
+func (j *Job) ID() int64 {
+	return j.id
+}
+
+// Context returns the context of the job.
+// It is canceled once an operator cancels or force-finishes the job.
+func (j *Job) Context() context.Context {
+	return j.ctx
+}
+
+// Start marks the job as running.
+func (j *Job) Start() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.startedAt = time.Now()
+	j.phase = PhaseChecking
+}
+
+// SetPhase moves the job into the phase p.
+func (j *Job) SetPhase(p Phase) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.phase = p
+}
+
+// SetPullRequestURL stores the URL of the pull request created for the job.
+func (j *Job) SetPullRequestURL(url string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.pullRequestURL = url
+}
+
+// SetStatuses stores the latest commit statuses reported for the pull request of the job.
+func (j *Job) SetStatuses(statuses []Status) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.statuses = statuses
+}
+
+// Hide keeps the job out of the active jobs and the history, e.g. because its change is private.
+func (j *Job) Hide() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.hidden = true
+}
+
+// Show reveals a hidden job, e.g. once it is known that its change isn`t private.
+func (j *Job) Show() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.hidden = false
+}
+
+// Hidden returns true if the job is kept out of the active jobs and the history.
+func (j *Job) Hidden() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.hidden
+}
+
+// Finish marks the job as done.
+// result is a short human readable outcome, vote the vote posted
+// to Gerrit (or nil if no vote was posted).
+func (j *Job) Finish(result string, vote *int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.phase = PhaseFinished
+	j.finishedAt = time.Now()
+	j.result = result
+	j.vote = vote
+	j.cancel()
+}
+
+// Cancel aborts the job without voting.
+// Like ForceFinish, it returns false if the job is already reporting its result to Gerrit or finished.
+func (j *Job) Cancel() bool {
+	j.mu.Lock()
+	if j.phase == PhaseReporting || j.phase == PhaseFinished {
+		j.mu.Unlock()
+		return false
+	}
+	j.mu.Unlock()
+
+	j.cancel()
+	return true
+}
+
+// ForceFinish aborts the job and asks it to post vote together with message to Gerrit.
+// It returns false if the job is already reporting its result to Gerrit or finished,
+// because the result can`t be replaced anymore.
+func (j *Job) ForceFinish(vote int, message string) bool {
+	j.mu.Lock()
+	if j.phase == PhaseReporting || j.phase == PhaseFinished {
+		j.mu.Unlock()
+		return false
+	}
+	j.forced = true
+	j.forcedVote = vote
+	j.forcedMessage = message
+	j.mu.Unlock()
+
+	j.cancel()
+	return true
+}
+
+// ForcedVote returns the vote and message requested by ForceFinish.
+// The last return value is false if the job was not force-finished.
+func (j *Job) ForcedVote() (int, string, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.forcedVote, j.forcedMessage, j.forced
+}
+
+// Info returns a snapshot of the current state of the job.
+func (j *Job) Info() Info {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	info := Info{
+		ID:             j.id,
+		Project:        j.message.Change.Project,
+		Branch:         j.message.Change.Branch,
+		Change:         j.message.Change.ID,
+		ChangeURL:      j.message.Change.URL,
+		Subject:        j.message.Change.Subject,
+		Patchset:       j.message.Patchset.Number,
+		Ref:            j.message.Patchset.Ref,
+		Phase:          j.phase,
+		PullRequestURL: j.pullRequestURL,
+		QueuedAt:       j.queuedAt,
+		Vote:           j.vote,
+		Result:         j.result,
+		Statuses:       append([]Status(nil), j.statuses...),
+	}
+
+	if !j.startedAt.IsZero() {
+		t := j.startedAt
+		info.StartedAt = &t
+	}
+	if !j.finishedAt.IsZero() {
+		t := j.finishedAt
+		info.FinishedAt = &t
+	}
+
+	return info
+}
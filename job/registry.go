@@ -0,0 +1,114 @@
+package job
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/andygrunwald/gotrap/gerrit"
+)
+
+// Registry holds all jobs which are currently queued or running.
+// Additionally the last finished jobs are kept as history.
+type Registry struct {
+	mu          sync.Mutex
+	nextID      int64
+	active      map[int64]*Job
+	history     []Info
+	historySize int
+}
+
+// NewRegistry returns an empty job registry.
+// historySize is the number of finished jobs kept in the history.
+func NewRegistry(historySize int) *Registry {
+	return &Registry{
+		active:      make(map[int64]*Job),
+		historySize: historySize,
+	}
+}
+
+// Add registers a new job for the message m.
+func (r *Registry) Add(m gerrit.Message) *Job {
+	return r.add(m, false)
+}
+
+// AddHidden registers a new hidden job for the message m (see Job.Hide).
+// It is used as long as it is unknown if the change of m is private.
+func (r *Registry) AddHidden(m gerrit.Message) *Job {
+	return r.add(m, true)
+}
+
+func (r *Registry) add(m gerrit.Message, hidden bool) *Job {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	j := newJob(r.nextID, m)
+	j.hidden = hidden
+	r.active[j.id] = j
+
+	return j
+}
+
+// Done moves the job j from the active jobs into the history.
+// Hidden jobs are not added to the history.
+// This has to be called once the job is finished.
+func (r *Registry) Done(j *Job) {
+	info := j.Info()
+	hidden := j.Hidden()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.active, j.id)
+
+	if r.historySize <= 0 || hidden {
+		return
+	}
+	r.history = append([]Info{info}, r.history...)
+	if len(r.history) > r.historySize {
+		r.history = r.history[:r.historySize]
+	}
+}
+
+// Get returns the active job with the identifier id.
+// Hidden jobs are not returned.
+func (r *Registry) Get(id int64) (*Job, bool) {
+	r.mu.Lock()
+	j, ok := r.active[id]
+	r.mu.Unlock()
+
+	if !ok || j.Hidden() {
+		return nil, false
+	}
+	return j, true
+}
+
+// Active returns a snapshot of all active jobs, oldest first.
+// Hidden jobs are not part of it.
+func (r *Registry) Active() []Info {
+	r.mu.Lock()
+	jobs := make([]*Job, 0, len(r.active))
+	for _, j := range r.active {
+		jobs = append(jobs, j)
+	}
+	r.mu.Unlock()
+
+	infos := make([]Info, 0, len(jobs))
+	for _, j := range jobs {
+		if j.Hidden() {
+			continue
+		}
+		infos = append(infos, j.Info())
+	}
+	sort.Slice(infos, func(i, k int) bool { return infos[i].ID < infos[k].ID })
+
+	return infos
+}
+
+// History returns a snapshot of the last finished jobs, newest first.
+func (r *Registry) History() []Info {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Info(nil), r.history...)
+}
@@ -0,0 +1,97 @@
+package job
+
+import (
+	"testing"
+
+	"github.com/andygrunwald/gotrap/gerrit"
+)
+
+func TestRegistryMovesFinishedJobsIntoHistory(t *testing.T) {
+	r := NewRegistry(2)
+
+	var jobs []*Job
+	for i := 1; i <= 3; i++ {
+		jobs = append(jobs, r.Add(gerrit.Message{Patchset: gerrit.Patchset{Number: uint(i)}}))
+	}
+	if active := r.Active(); len(active) != 3 || active[0].ID != 1 || active[2].ID != 3 {
+		t.Fatalf("Expected 3 active jobs (oldest first), got %+v", active)
+	}
+
+	for _, j := range jobs {
+		j.Start()
+		j.Finish("verified: success", nil)
+		r.Done(j)
+	}
+
+	if active := r.Active(); len(active) != 0 {
+		t.Errorf("Expected no active jobs, got %+v", active)
+	}
+	if _, ok := r.Get(1); ok {
+		t.Error("Expected finished job 1 to be gone")
+	}
+
+	// The history is limited and the newest job comes first
+	history := r.History()
+	if len(history) != 2 || history[0].ID != 3 || history[1].ID != 2 {
+		t.Fatalf("Expected jobs 3 and 2 in the history, got %+v", history)
+	}
+	if history[0].Phase != PhaseFinished || history[0].Result != "verified: success" || history[0].FinishedAt == nil {
+		t.Errorf("Unexpected history entry %+v", history[0])
+	}
+}
+
+func TestRegistryWithoutHistory(t *testing.T) {
+	r := NewRegistry(0)
+	j := r.Add(gerrit.Message{})
+	j.Finish("canceled by operator", nil)
+	r.Done(j)
+
+	if history := r.History(); len(history) != 0 {
+		t.Errorf("Expected no history, got %+v", history)
+	}
+}
+
+func TestForceFinishIsRejectedWhileReporting(t *testing.T) {
+	j := NewRegistry(0).Add(gerrit.Message{})
+	j.Start()
+	j.SetPhase(PhaseReporting)
+
+	if j.ForceFinish(-1, "CI is down") {
+		t.Error("Expected ForceFinish to be rejected")
+	}
+	if _, _, forced := j.ForcedVote(); forced || j.Context().Err() != nil {
+		t.Error("Expected the job to keep running")
+	}
+}
+
+func TestRegistryKeepsHiddenJobsOutOfHistory(t *testing.T) {
+	r := NewRegistry(2)
+	j := r.Add(gerrit.Message{})
+	j.Hide()
+	j.Finish("skipped: change is private", nil)
+	r.Done(j)
+
+	if history := r.History(); len(history) != 0 {
+		t.Errorf("Expected no history, got %+v", history)
+	}
+}
+
+func TestRegistryHidesJobsUntilTheyAreShown(t *testing.T) {
+	r := NewRegistry(2)
+	j := r.AddHidden(gerrit.Message{})
+
+	if active := r.Active(); len(active) != 0 {
+		t.Errorf("Expected no active jobs, got %+v", active)
+	}
+	if _, ok := r.Get(j.ID()); ok {
+		t.Error("Expected the hidden job not to be found")
+	}
+
+	j.Show()
+	if active := r.Active(); len(active) != 1 {
+		t.Errorf("Expected the shown job to be active, got %+v", active)
+	}
+	if _, ok := r.Get(j.ID()); !ok {
+		t.Error("Expected the shown job to be found")
+	}
+}
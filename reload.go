@@ -0,0 +1,46 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/andygrunwald/gotrap/config"
+	"github.com/andygrunwald/gotrap/stream"
+)
+
+// reloadOnSignal reloads the configuration file every time gotrap receives a SIGHUP.
+// The new configuration is validated first. If it is invalid, the old one stays active.
+// Switching to another stream type (gotrap.stream) requires a restart.
+func reloadOnSignal(configFile *string, streamName string, s stream.Stream) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	go func() {
+		for range signals {
+			log.Printf("> SIGHUP received. Reloading configuration %s", *configFile)
+
+			c, err := config.NewConfiguration(configFile)
+			if err != nil {
+				log.Printf("> Configuration reload failed, keeping the old one: %s", err)
+				continue
+			}
+			logRedactor.AddSecrets(secrets(c)...)
+			if err := c.Validate(); err != nil {
+				log.Printf("> Configuration reload failed, keeping the old one: %s", err)
+				continue
+			}
+			if c.Gotrap.Stream != streamName {
+				log.Printf("> Configuration reload failed, keeping the old one: Changing gotrap.stream from \"%s\" to \"%s\" requires a restart", streamName, c.Gotrap.Stream)
+				continue
+			}
+			if *flagDryRun {
+				c.Gotrap.DryRun = true
+			}
+
+			s.Reload(c)
+			log.Println("> Configuration reloaded. New jobs will use the new configuration.")
+		}
+	}()
+}
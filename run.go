@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/andygrunwald/gotrap/config"
+	"github.com/andygrunwald/gotrap/gerrit"
+	"github.com/andygrunwald/gotrap/job"
+	"github.com/andygrunwald/gotrap/stream"
+)
+
+// runCommand verifies a single change in the foreground.
+// The change is fetched via the Gerrit REST API and handled like a
+// "patchset-created" message received by the stream.
+//
+//	gotrap run --config config.json --change <id|number> [--patchset N] [--dry-run]
+func runCommand(args []string) {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	configFile := flags.String("config", "", "Path to configuration file.")
+	changeID := flags.String("change", "", "Change to verify (Change-Id or change number).")
+	patchsetNumber := flags.Uint("patchset", 0, "Patchset number to verify. Only the current patchset can be verified. Default: Current patchset.")
+	dryRun := flags.Bool("dry-run", false, "Evaluate the change, but never write to Gerrit or Github.")
+	flags.Parse(args)
+
+	if len(*configFile) <= 0 {
+		log.Fatal("No configuration file found. Please add the --config parameter")
+	}
+	if len(*changeID) <= 0 {
+		log.Fatal("No change found. Please add the --change parameter")
+	}
+
+	config, err := config.NewConfiguration(configFile)
+	if err != nil {
+		log.Fatal("Configuration initialisation failed:", err)
+	}
+	logRedactor.SetSecrets(secrets(config)...)
+	if err := config.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if *dryRun {
+		config.Gotrap.DryRun = true
+	}
+
+	gerritClient := gerrit.NewGerritClient(&config.Gerrit)
+	change, err := gerritClient.GetChangeWithAllRevisions(context.Background(), *changeID)
+	if err != nil {
+		log.Fatalf("Getting change %s failed: %s", *changeID, err)
+	}
+
+	message, err := gerritClient.NewPatchsetCreatedMessage(change, *patchsetNumber)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Outdated patchsets are always skipped, see stream.Gotrap
+	if current := change.Revisions[change.CurrentRevision].Number; message.Patchset.Number != current {
+		log.Fatalf("Patchset %d of change %d is outdated. Only the current patchset %d can be verified", message.Patchset.Number, change.Number, current)
+	}
+
+	jobs := job.NewRegistry(0)
+	j := jobs.Add(*message)
+	stream.NewGotrap(config, *message, j).TakeAction()
+
+	info := j.Info()
+	fmt.Printf("Change:       %s (%s)\n", info.Subject, info.ChangeURL)
+	fmt.Printf("Patchset:     %d (%s)\n", info.Patchset, info.Ref)
+	if len(info.PullRequestURL) > 0 {
+		fmt.Printf("Pull request: %s\n", info.PullRequestURL)
+	}
+	for _, s := range info.Statuses {
+		fmt.Printf("Status:       %s: %s (%s)\n", s.Context, s.State, s.TargetURL)
+	}
+	fmt.Printf("Result:       %s\n", info.Result)
+	if info.Vote != nil {
+		fmt.Printf("Vote:         %d\n", *info.Vote)
+	}
+	fmt.Printf("Duration:     %s\n", info.Duration())
+}
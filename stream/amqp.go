@@ -1,12 +1,21 @@
 package stream
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"fmt"
+	"github.com/andygrunwald/gotrap/backoff"
 	"github.com/andygrunwald/gotrap/config"
 	"github.com/andygrunwald/gotrap/gerrit"
-	"github.com/andygrunwald/gotrap/github"
+	"github.com/andygrunwald/gotrap/job"
 	"github.com/streadway/amqp"
+	"io/ioutil"
+	"log"
+	"math"
+	"reflect"
 	"sync"
+	"time"
 )
 
 type AmqpStream struct {
@@ -14,142 +23,365 @@ type AmqpStream struct {
 	Connection *amqp.Connection
 	Channel    *amqp.Channel
 	Config     *config.Configuration
+
+	mu         sync.Mutex
+	dispatcher *dispatcher
+	backoff    backoff.Backoff
+	done       chan struct{}
+	stop       sync.Once
 }
 
 func init() {
 	Streams[StreamAmqp] = new(AmqpStream)
 }
 
-func (s *AmqpStream) Initialize(config *config.Configuration) {
+func (s *AmqpStream) Initialize(config *config.Configuration, jobs *job.Registry) {
 	s.Config = config
+	s.dispatcher = newDispatcher(config, jobs)
+	s.backoff = backoff.Default
+	s.done = make(chan struct{})
 }
 
-func (s *AmqpStream) Start() error {
-	var wg sync.WaitGroup
-	// Limit number of concurrent patch requests here with a semaphore
-	sem := make(chan bool, s.Config.Gotrap.Concurrent)
+// Reload swaps the configuration used for new jobs.
+// Running jobs finish with the configuration they were started with.
+// If the AMQP settings changed, the connection to the AMQP broker will be reestablished.
+func (s *AmqpStream) Reload(c *config.Configuration) {
+	s.mu.Lock()
+	old := s.Config
+	s.Config = c
+	connection, channel := s.Connection, s.Channel
+	s.mu.Unlock()
 
-	// We have to do this in a loop, to reconnect to rabbitmq automatically
-	// This connection times out sometimes.
-	for {
-		// If we don`t get a AMQP connection we can exit here
-		// Without AMQP connection gotrap is useless
-		if err := s.Connect(); err != nil {
-			return err
-		}
-		defer s.Connection.Close()
+	s.dispatcher.SetConfiguration(c)
 
-		// Declare AMQP exchange and queue and bind them together :)
-		// If this will fail we can exit here with the same reason like above
-		// Without queue gotrap is useless
-		if err := s.DeclareAndBind(&s.Config.Amqp); err != nil {
-			return err
+	if !reflect.DeepEqual(old.Amqp, c.Amqp) && connection != nil {
+		log.Println("> AMQP settings changed. Reconnecting to the AMQP broker.")
+		connection.Close()
+		return
+	}
+
+	// The prefetch follows gotrap.concurrent, if it isn`t configured explicitly
+	if prefetch := prefetchCount(c); prefetch != prefetchCount(old) && channel != nil {
+		if err := channel.Qos(prefetch, 0, false); err != nil {
+			log.Printf("> Updating the AMQP prefetch failed: %s", err)
 		}
+	}
+}
+
+// prefetchCount returns the number of unacknowledged messages the broker sends.
+// Without prefetch setting, gotrap fetches as many messages as it handles concurrently.
+func prefetchCount(c *config.Configuration) int {
+	if c.Amqp.Prefetch > 0 {
+		return c.Amqp.Prefetch
+	}
+
+	return c.Gotrap.Concurrent
+}
+
+// configuration returns the current configuration.
+func (s *AmqpStream) configuration() *config.Configuration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.Config
+}
+
+// amqpSession is a single connection to the AMQP broker consuming messages.
+type amqpSession struct {
+	deliveries <-chan amqp.Delivery
+	closed     <-chan *amqp.Error
+	close      func() error
+}
+
+// Start consumes messages from the AMQP broker until Stop is called.
+// If the connection to the broker can`t be established or gets lost,
+// gotrap reconnects with an exponential backoff.
+func (s *AmqpStream) Start() error {
+	err := s.consume(s.open)
+	s.dispatcher.Wait()
+
+	return err
+}
+
+// Stop stops consuming messages.
+// Start returns after all running jobs are finished.
+func (s *AmqpStream) Stop() {
+	s.stop.Do(func() {
+		close(s.done)
+	})
+}
+
+// consume is the reconnection supervisor.
+// It opens a session via open and hands over all messages to the dispatcher.
+// If the session is closed, a new one will be opened.
+// Failed attempts are retried with an exponential backoff.
+func (s *AmqpStream) consume(open func() (*amqpSession, error)) error {
+	attempt := 0
 
-		// Get the consumer channel to get all messages
-		messages, err := s.Channel.Consume(s.Config.Amqp.Queue, s.Config.Amqp.Identifier, false, false, false, false, nil)
+	for {
+		session, err := open()
 		if err != nil {
-			return err
+			delay := s.backoff.Duration(attempt)
+			attempt++
+			log.Printf("> Connecting to AMQP broker failed (attempt %d): %s. Next try in %s", attempt, err, delay)
+
+			select {
+			case <-time.After(delay):
+				continue
+			case <-s.done:
+				return nil
+			}
 		}
 
-		// Get new messages by the AMQP broker
-		for event := range messages {
-			// Semaphore! Fill it
-			sem <- true
-			wg.Add(1)
-
-			// One go routine per message
-			go func() {
-				defer func() {
-					// Semaphore! Release it if this message was handled
-					<-sem
-					wg.Done()
-				}()
-
-				// Acknowledge message if we get this
-				// We do this, because at the end of proceeding we might lost the connection to AMQP server
-				// I know this is wrong, but currently the reconnection does not work correctly :(
-				// TODO: Fix this later and Ack message if its done
-				event.Ack(false)
-
-				// Convert the AMQP into a Gerrit message
-				var change gerrit.Message
-				err := json.Unmarshal(event.Body, &change)
-				// If we can`t read the message, we will exit here
-				if err != nil {
-					return
+		attempt = 0
+		log.Println("> Connected to AMQP broker. Waiting for messages.")
+
+	Consume:
+		for {
+			select {
+			case event, ok := <-session.deliveries:
+				if !ok {
+					log.Println("> AMQP consumer closed. Reconnecting.")
+					break Consume
 				}
+				s.handle(event)
 
-				// Build the main data structure and start working on the message :)
-				gotrap := Gotrap{
-					githubClient: *github.NewGithubClient(&s.Config.Github),
-					gerritClient: *gerrit.NewGerritClient(&s.Config.Gerrit),
-					config:       s.Config,
-					Message:      change,
+			case err := <-session.closed:
+				// err is nil if the connection was closed by gotrap (e.g. during a reload)
+				if err != nil {
+					log.Printf("> Connection to AMQP broker lost: %s. Reconnecting.", err)
 				}
-				gotrap.TakeAction()
-			}()
+				break Consume
+
+			case <-s.done:
+				// Messages can only be acknowledged as long as the session is open
+				s.dispatcher.Wait()
+				session.close()
+				return nil
+			}
 		}
+
+		session.close()
 	}
+}
 
-	wg.Wait()
-	return nil
+// handle converts the AMQP delivery into a Gerrit message and dispatches it.
+// The delivery is acknowledged once the message was handled, so the broker delivers it again
+// if gotrap crashes in the meantime. If the session was closed meanwhile (e.g. during a reload),
+// the acknowledgement fails and the broker delivers the message again as well.
+// Patchsets which are verified already are skipped then.
+func (s *AmqpStream) handle(event amqp.Delivery) {
+	ack := func() {
+		if err := event.Ack(false); err != nil {
+			log.Printf("> Acknowledging AMQP message failed: %s", err)
+		}
+	}
+
+	// Convert the AMQP into a Gerrit message
+	var change gerrit.Message
+	err := json.Unmarshal(event.Body, &change)
+	// If we can`t read the message, we will skip it
+	if err != nil {
+		log.Printf("> Skipped AMQP message, because it can`t be read: %s", err)
+		ack()
+		return
+	}
+
+	s.dispatcher.Dispatch(change, ack)
+}
+
+// open connects to the AMQP broker, declares the topology and starts consuming.
+func (s *AmqpStream) open() (*amqpSession, error) {
+	config := s.configuration()
+
+	if err := s.Connect(); err != nil {
+		return nil, err
+	}
+	connection := s.Connection
+
+	// Declare AMQP exchange and queue and bind them together :)
+	if err := s.DeclareAndBind(&config.Amqp); err != nil {
+		connection.Close()
+		return nil, err
+	}
+
+	// Limit the number of unacknowledged messages
+	if err := s.Channel.Qos(prefetchCount(config), 0, false); err != nil {
+		connection.Close()
+		return nil, err
+	}
+
+	// Get the consumer channel to get all messages
+	deliveries, err := s.Channel.Consume(config.Amqp.Queue, config.Amqp.Identifier, false, false, false, false, nil)
+	if err != nil {
+		connection.Close()
+		return nil, err
+	}
+
+	session := &amqpSession{
+		deliveries: deliveries,
+		closed:     connection.NotifyClose(make(chan *amqp.Error, 1)),
+		close: func() error {
+			if connection.IsClosed() {
+				return nil
+			}
+			return connection.Close()
+		},
+	}
+
+	return session, nil
 }
 
 // Connect connects to the AMQP server.
 // The credentials are received by the AmqpInstance struct
 func (s *AmqpStream) Connect() error {
+	config := s.configuration()
 
-	s.URI = &amqp.URI{
-		Scheme:   "amqp",
-		Host:     s.Config.Amqp.Host,
-		Port:     s.Config.Amqp.Port,
-		Username: s.Config.Amqp.Username,
-		Password: s.Config.Amqp.Password,
-		Vhost:    s.Config.Amqp.VHost,
+	uri := &amqp.URI{
+		Scheme:   config.Amqp.Scheme,
+		Host:     config.Amqp.Host,
+		Port:     config.Amqp.Port,
+		Username: config.Amqp.Username,
+		Password: config.Amqp.Password,
+		Vhost:    config.Amqp.VHost,
 	}
 
-	var err error
+	amqpConfig := amqp.Config{
+		Vhost:     config.Amqp.VHost,
+		Heartbeat: time.Duration(config.Amqp.Heartbeat) * time.Second,
+		Properties: amqp.Table{
+			"product": "gotrap",
+		},
+	}
+	if len(config.Amqp.ConnectionName) > 0 {
+		amqpConfig.Properties["connection_name"] = config.Amqp.ConnectionName
+	}
+
+	if config.Amqp.Scheme == "amqps" {
+		tlsConfig, err := newTLSConfig(&config.Amqp.TLS)
+		if err != nil {
+			return err
+		}
+		amqpConfig.TLSClientConfig = tlsConfig
+	}
+
+	// With EXTERNAL, the broker authenticates us by our client certificate
+	if config.Amqp.SASLExternal {
+		amqpConfig.SASL = []amqp.Authentication{&externalAuth{}}
+	}
 
 	// Open an AMQP connection
-	s.Connection, err = amqp.Dial(s.URI.String())
+	connection, err := amqp.DialConfig(uri.String(), amqpConfig)
 	if err != nil {
 		return err
 	}
 
 	// Open the channel in the new connection
-	s.Channel, err = s.Connection.Channel()
+	channel, err := connection.Channel()
 	if err != nil {
-		s.Connection.Close()
+		connection.Close()
 		return err
 	}
 
+	s.mu.Lock()
+	s.URI = uri
+	s.Connection = connection
+	s.Channel = channel
+	s.mu.Unlock()
+
 	return nil
 }
 
+// newTLSConfig builds the TLS configuration for amqps connections.
+// Without a CA bundle, the CA certificates of the system are used.
+func newTLSConfig(c *config.AmqpTLSConfiguration) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if len(c.CAFile) > 0 {
+		ca, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("No certificates found in CA bundle %s", c.CAFile)
+		}
+	}
+
+	if len(c.CertFile) > 0 {
+		certificate, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return tlsConfig, nil
+}
+
+// externalAuth is the SASL mechanism EXTERNAL.
+// The broker authenticates the client by its TLS client certificate.
+type externalAuth struct{}
+
+// Mechanism returns "EXTERNAL"
+func (auth *externalAuth) Mechanism() string {
+	return "EXTERNAL"
+}
+
+// Response returns an empty response, because the identity is taken from the certificate.
+func (auth *externalAuth) Response() string {
+	return ""
+}
+
+// VerifyCredentials checks if the AMQP broker accepts the configured credentials.
+// It only opens and closes a connection.
+func (s *AmqpStream) VerifyCredentials() error {
+	if err := s.Connect(); err != nil {
+		return err
+	}
+
+	return s.Connection.Close()
+}
+
 // DeclareAndBind defines the exchange and queue at the AMQP server.
 // We declare our topology on both the publisher and consumer to ensure they
 // are the same. This is part of AMQP being a programmable messaging model.
 // After declaring we are binding it to be able to receive messages in the queue by the exchange.
+// In passive mode, exchange and queue are not declared. We only check that they exist.
 func (s *AmqpStream) DeclareAndBind(config *config.AmqpConfiguration) error {
+	var err error
 
 	// Settings:
-	//	type: fanout
-	// 	durable: false
-	//	autoDelete: false
+	//	type: exchange-type (default: fanout)
+	// 	durable: exchange-durable (default: false)
+	//	autoDelete: exchange-auto-delete (default: false)
 	//	internal: false
 	//	noWait: false
-	err := s.Channel.ExchangeDeclare(config.Exchange, "fanout", false, false, false, false, nil)
+	if config.Passive {
+		err = s.Channel.ExchangeDeclarePassive(config.Exchange, config.ExchangeType, config.ExchangeDurable, config.ExchangeAutoDelete, false, false, nil)
+	} else {
+		err = s.Channel.ExchangeDeclare(config.Exchange, config.ExchangeType, config.ExchangeDurable, config.ExchangeAutoDelete, false, false, nil)
+	}
 	if err != nil {
 		return err
 	}
 
 	// Settings:
-	// 	durable: true
-	//	autoDelete: false
+	// 	durable: queue-durable (default: true)
+	//	autoDelete: queue-auto-delete (default: false)
 	//	exclusive: false
 	//	noWait: false
-	_, err = s.Channel.QueueDeclare(config.Queue, true, false, false, false, nil)
+	//	arguments: queue-arguments (e.g. x-message-ttl, x-max-length or x-queue-type)
+	arguments := queueArguments(config.QueueArguments)
+	if config.Passive {
+		_, err = s.Channel.QueueDeclarePassive(config.Queue, config.QueueDurable, config.QueueAutoDelete, false, false, arguments)
+	} else {
+		_, err = s.Channel.QueueDeclare(config.Queue, config.QueueDurable, config.QueueAutoDelete, false, false, arguments)
+	}
 	if err != nil {
 		return err
 	}
@@ -161,3 +393,22 @@ func (s *AmqpStream) DeclareAndBind(config *config.AmqpConfiguration) error {
 
 	return nil
 }
+
+// queueArguments converts the configured queue arguments into an AMQP table.
+// Numbers in the configuration are floats, but RabbitMQ expects
+// integers for arguments like x-message-ttl or x-max-length.
+func queueArguments(arguments map[string]interface{}) amqp.Table {
+	if len(arguments) == 0 {
+		return nil
+	}
+
+	table := make(amqp.Table, len(arguments))
+	for key, value := range arguments {
+		if f, ok := value.(float64); ok && f == math.Trunc(f) {
+			value = int64(f)
+		}
+		table[key] = value
+	}
+
+	return table
+}
@@ -0,0 +1,176 @@
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andygrunwald/gotrap/backoff"
+	"github.com/andygrunwald/gotrap/config"
+	"github.com/andygrunwald/gotrap/job"
+	"github.com/streadway/amqp"
+)
+
+// fakeBroker is a stand-in for the AMQP broker.
+// Every call of open returns the next prepared session or error.
+type fakeBroker struct {
+	mu       sync.Mutex
+	sessions []*fakeSession
+	errs     []error
+	opened   int
+	acked    []uint64
+}
+
+type fakeSession struct {
+	deliveries chan amqp.Delivery
+	closed     chan *amqp.Error
+	isClosed   chan struct{}
+}
+
+func newFakeSession() *fakeSession {
+	return &fakeSession{
+		deliveries: make(chan amqp.Delivery),
+		closed:     make(chan *amqp.Error, 1),
+		isClosed:   make(chan struct{}),
+	}
+}
+
+func (b *fakeBroker) open() (*amqpSession, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.opened++
+	if len(b.errs) > 0 {
+		err := b.errs[0]
+		b.errs = b.errs[1:]
+		return nil, err
+	}
+
+	fs := b.sessions[0]
+	b.sessions = b.sessions[1:]
+
+	return &amqpSession{
+		deliveries: fs.deliveries,
+		closed:     fs.closed,
+		close: func() error {
+			close(fs.isClosed)
+			return nil
+		},
+	}, nil
+}
+
+func (b *fakeBroker) Ack(tag uint64, multiple bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.acked = append(b.acked, tag)
+	return nil
+}
+
+func (b *fakeBroker) Nack(tag uint64, multiple bool, requeue bool) error { return nil }
+func (b *fakeBroker) Reject(tag uint64, requeue bool) error              { return nil }
+
+func waitFor(t *testing.T, c <-chan struct{}, what string) {
+	select {
+	case <-c:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timeout while waiting for %s", what)
+	}
+}
+
+func TestConsumeReconnectsAfterFailuresAndConnectionLoss(t *testing.T) {
+	first, second := newFakeSession(), newFakeSession()
+	broker := &fakeBroker{
+		errs:     []error{errors.New("connection refused"), errors.New("connection refused")},
+		sessions: []*fakeSession{first, second},
+	}
+
+	c := new(config.Configuration)
+	c.Gotrap.Concurrent = 1
+
+	s := new(AmqpStream)
+	s.Initialize(c, job.NewRegistry(0))
+	s.backoff = backoff.Backoff{Initial: time.Millisecond, Max: time.Millisecond, Multiplier: 2}
+
+	result := make(chan error)
+	go func() {
+		result <- s.consume(broker.open)
+	}()
+
+	// The first session delivers a message and gets lost afterwards
+	first.deliveries <- amqp.Delivery{Acknowledger: broker, DeliveryTag: 1, Body: []byte(`{"type": "ref-updated"}`)}
+	first.closed <- amqp.ErrClosed
+	waitFor(t, first.isClosed, "closing the lost session")
+
+	// The second session is opened automatically and keeps consuming
+	second.deliveries <- amqp.Delivery{Acknowledger: broker, DeliveryTag: 2, Body: []byte(`invalid`)}
+
+	s.Stop()
+	waitFor(t, second.isClosed, "closing the session on stop")
+
+	if err := <-result; err != nil {
+		t.Errorf("Expected no error, got %s", err)
+	}
+
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	if broker.opened != 4 {
+		t.Errorf("Expected 4 connection attempts, got %d", broker.opened)
+	}
+	if len(broker.acked) != 2 || broker.acked[0] != 1 || broker.acked[1] != 2 {
+		t.Errorf("Expected deliveries 1 and 2 to be acknowledged, got %v", broker.acked)
+	}
+}
+
+func TestDeliveriesAreAcknowledgedAfterTheJob(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		fmt.Fprint(w, `{"status": "MERGED"}`)
+	}))
+	defer ts.Close()
+
+	session := newFakeSession()
+	broker := &fakeBroker{sessions: []*fakeSession{session}}
+
+	c := new(config.Configuration)
+	c.Gotrap.Concurrent = 1
+	c.Gerrit.URL = ts.URL
+	c.Gerrit.Projects = map[string]map[string]bool{"Packages/TYPO3.CMS": {}}
+
+	s := new(AmqpStream)
+	s.Initialize(c, job.NewRegistry(0))
+
+	result := make(chan error)
+	go func() {
+		result <- s.consume(broker.open)
+	}()
+
+	session.deliveries <- amqp.Delivery{Acknowledger: broker, DeliveryTag: 1, Body: []byte(`{"type": "patchset-created", "change": {"project": "Packages/TYPO3.CMS", "branch": "master", "id": "I123"}, "patchSet": {"number": "1"}}`)}
+	waitFor(t, started, "the job")
+
+	broker.mu.Lock()
+	acked := len(broker.acked)
+	broker.mu.Unlock()
+	if acked != 0 {
+		t.Errorf("Expected no acknowledgement while the job is running, got %d", acked)
+	}
+
+	// Stopping waits for the job, so the delivery is acknowledged before the session is closed
+	s.Stop()
+	close(release)
+	waitFor(t, session.isClosed, "closing the session on stop")
+	<-result
+
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	if len(broker.acked) != 1 || broker.acked[0] != 1 {
+		t.Errorf("Expected delivery 1 to be acknowledged, got %v", broker.acked)
+	}
+}
@@ -0,0 +1,170 @@
+package stream
+
+import (
+	"context"
+	"github.com/andygrunwald/gotrap/config"
+	"github.com/andygrunwald/gotrap/gerrit"
+	gogithub "github.com/google/go-github/github"
+	"log"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// invalidCheckerChars matches all characters which are not allowed in the id of a checker UUID.
+var invalidCheckerChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// knownCheckers contains the UUIDs of the checkers which exist in Gerrit.
+// Checkers are shared by all jobs, so every checker is only requested once.
+var knownCheckers = struct {
+	sync.Mutex
+	uuids map[string]bool
+}{uuids: make(map[string]bool)}
+
+// checksReporter reports the Github status contexts of a pull request
+// as checks of the Gerrit checks plugin. Every status context is a checker.
+// The check of a revision is updated on every state transition.
+type checksReporter struct {
+	client  gerrit.GerritInstance
+	config  *config.GerritChecksConfiguration
+	message gerrit.Message
+
+	states  map[string]string
+	started map[string]time.Time
+}
+
+func newChecksReporter(c *config.GerritChecksConfiguration, client gerrit.GerritInstance, m gerrit.Message) *checksReporter {
+	return &checksReporter{
+		client:  client,
+		config:  c,
+		message: m,
+		states:  make(map[string]string),
+		started: make(map[string]time.Time),
+	}
+}
+
+// Schedule reports the configured contexts as scheduled,
+// because Github only knows contexts after the first status was reported.
+func (r *checksReporter) Schedule() {
+	for _, statusContext := range r.config.Contexts {
+		r.report(statusContext, gerrit.CheckStateScheduled, "", "")
+	}
+}
+
+// Report updates the checks of all contexts of s whose state changed.
+func (r *checksReporter) Report(s *gogithub.CombinedStatus) {
+	for _, status := range s.Statuses {
+		r.report(status.GetContext(), checkState(status.GetState()), status.GetDescription(), status.GetTargetURL())
+	}
+}
+
+// Abort marks all checks which are not finished yet as failed.
+func (r *checksReporter) Abort(message string) {
+	contexts := make([]string, 0, len(r.states))
+	for statusContext, state := range r.states {
+		if !isFinalCheckState(state) {
+			contexts = append(contexts, statusContext)
+		}
+	}
+	sort.Strings(contexts)
+
+	for _, statusContext := range contexts {
+		r.report(statusContext, gerrit.CheckStateFailed, message, "")
+	}
+}
+
+// report creates or updates the check of statusContext, if its state changed.
+// Errors are only logged, because the checks are additional to the review.
+// The checks are reported independent of the job context, because a canceled job reports its checks as well.
+func (r *checksReporter) report(statusContext, state, message, url string) {
+	if r.states[statusContext] == state {
+		return
+	}
+
+	uuid, err := r.ensureChecker(statusContext)
+	if err != nil {
+		log.Printf("> Error during registering the checker for \"%s\": %s", statusContext, err)
+		return
+	}
+
+	input := &gerrit.CheckInput{
+		CheckerUUID: uuid,
+		State:       state,
+		Message:     message,
+		URL:         url,
+	}
+	if state == gerrit.CheckStateRunning || isFinalCheckState(state) {
+		if _, ok := r.started[statusContext]; !ok {
+			r.started[statusContext] = time.Now()
+		}
+		input.Started = gerrit.NewTimestamp(r.started[statusContext])
+	}
+	if isFinalCheckState(state) {
+		input.Finished = gerrit.NewTimestamp(time.Now())
+	}
+
+	if err := r.client.PostCheck(context.Background(), r.message.Change.ID, r.message.Patchset.Revision, input); err != nil {
+		log.Printf("> Error during reporting the check \"%s\" (%s): %s", statusContext, state, err)
+		return
+	}
+
+	log.Printf("> Check \"%s\" reported as %s", statusContext, state)
+	r.states[statusContext] = state
+}
+
+// ensureChecker registers the checker of statusContext, if it doesn`t exist yet.
+// It returns the UUID of the checker.
+func (r *checksReporter) ensureChecker(statusContext string) (string, error) {
+	uuid := checkerUUID(r.config.Scheme, r.message.Change.Project, statusContext)
+
+	knownCheckers.Lock()
+	known := knownCheckers.uuids[uuid]
+	knownCheckers.Unlock()
+	if known {
+		return uuid, nil
+	}
+
+	_, err := r.client.GetChecker(context.Background(), uuid)
+	if gerrit.IsNotFound(err) {
+		err = r.client.CreateChecker(context.Background(), &gerrit.CheckerInput{
+			UUID:        uuid,
+			Name:        statusContext,
+			Description: "Github status context reported by gotrap",
+			Repository:  r.message.Change.Project,
+			Status:      "ENABLED",
+		})
+	}
+	if err != nil {
+		return "", err
+	}
+
+	knownCheckers.Lock()
+	knownCheckers.uuids[uuid] = true
+	knownCheckers.Unlock()
+
+	return uuid, nil
+}
+
+// checkerUUID returns the UUID of the checker of the status context in project,
+// e.g. "gotrap:Packages-TYPO3.CMS-continuous-integration-travis-ci".
+// A checker belongs to a single repository, so the project is part of the UUID.
+func checkerUUID(scheme, project, statusContext string) string {
+	return scheme + ":" + invalidCheckerChars.ReplaceAllString(project+"-"+statusContext, "-")
+}
+
+// checkState converts the state of a Github commit status into the state of a check.
+func checkState(state string) string {
+	switch state {
+	case "success":
+		return gerrit.CheckStateSuccessful
+	case "failure", "error":
+		return gerrit.CheckStateFailed
+	default:
+		return gerrit.CheckStateRunning
+	}
+}
+
+func isFinalCheckState(state string) bool {
+	return state == gerrit.CheckStateSuccessful || state == gerrit.CheckStateFailed
+}
@@ -0,0 +1,82 @@
+package stream
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/andygrunwald/gotrap/config"
+	"github.com/andygrunwald/gotrap/gerrit"
+	gogithub "github.com/google/go-github/github"
+)
+
+func TestChecksReporterReportsTransitions(t *testing.T) {
+	var mu sync.Mutex
+	var createdCheckers []string
+	var checks []gerrit.CheckInput
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/a/plugins/checks/checkers/"):
+			http.NotFound(w, r)
+		case r.Method == "POST" && r.URL.Path == "/a/plugins/checks/checkers/":
+			var input gerrit.CheckerInput
+			json.NewDecoder(r.Body).Decode(&input)
+			createdCheckers = append(createdCheckers, input.UUID)
+		case r.Method == "POST" && r.URL.Path == "/a/changes/I123/revisions/abc/checks/":
+			var input gerrit.CheckInput
+			json.NewDecoder(r.Body).Decode(&input)
+			checks = append(checks, input)
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+
+	m := gerrit.Message{
+		Change:   gerrit.Change{ID: "I123", Project: "Packages/TYPO3.CMS"},
+		Patchset: gerrit.Patchset{Revision: "abc"},
+	}
+	c := &config.GerritChecksConfiguration{Enabled: true, Scheme: "test-transitions", Contexts: []string{"continuous-integration/travis-ci"}}
+	r := newChecksReporter(c, gerrit.GerritInstance{URL: ts.URL}, m)
+
+	status := func(state string) *gogithub.CombinedStatus {
+		return &gogithub.CombinedStatus{
+			Statuses: []gogithub.RepoStatus{
+				{Context: gogithub.String("continuous-integration/travis-ci"), State: gogithub.String(state)},
+			},
+		}
+	}
+
+	r.Schedule()
+	r.Report(status("pending"))
+	r.Report(status("pending"))
+	r.Report(status("success"))
+	r.Abort("canceled")
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(createdCheckers) != 1 || createdCheckers[0] != "test-transitions:Packages-TYPO3.CMS-continuous-integration-travis-ci" {
+		t.Errorf("Expected one checker to be created, got %v", createdCheckers)
+	}
+
+	expected := []string{gerrit.CheckStateScheduled, gerrit.CheckStateRunning, gerrit.CheckStateSuccessful}
+	if len(checks) != len(expected) {
+		t.Fatalf("Expected %d check updates, got %v", len(expected), checks)
+	}
+	for i, state := range expected {
+		if checks[i].State != state {
+			t.Errorf("Expected update %d to be %s, got %s", i, state, checks[i].State)
+		}
+	}
+	if checks[2].Started == nil || checks[2].Finished == nil {
+		t.Errorf("Expected start and finish time for the final check, got %+v", checks[2])
+	}
+}
@@ -0,0 +1,92 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"github.com/andygrunwald/gotrap/gerrit"
+	"github.com/andygrunwald/gotrap/github"
+	gogithub "github.com/google/go-github/github"
+	"log"
+	"strconv"
+)
+
+// addInlineComments adds the annotations of the check runs of pullRequest
+// as inline comments (or robot comments) to review.
+// If the annotations or the files of the patchset can`t be requested,
+// the review is posted without inline comments.
+func (trap *Gotrap) addInlineComments(ctx context.Context, review *gerrit.ReviewInput, pullRequest *gogithub.PullRequest) {
+	annotations, err := trap.githubClient.ListAnnotations(ctx, *pullRequest)
+	if err != nil {
+		log.Printf("> Error during requesting the check run annotations: %s", err)
+		return
+	}
+	if len(annotations) == 0 {
+		return
+	}
+
+	files, err := trap.gerritClient.ListFiles(ctx, trap.Message.Change.ID, trap.Message.Patchset.Revision)
+	if err != nil {
+		log.Printf("> Error during requesting the files of the patchset: %s", err)
+		return
+	}
+
+	added := inlineComments(review, annotations, files, trap.config.Gerrit.InlineComments == "robot-comments")
+	log.Printf("> %d of %d annotations added as inline comments", added, len(annotations))
+}
+
+// inlineComments converts annotations into inline comments of review.
+// With robot, robot comments are used instead of regular comments.
+// Annotations of files which are not part of the patchset are dropped,
+// because Gerrit rejects comments on them.
+// It returns the number of added comments.
+func inlineComments(review *gerrit.ReviewInput, annotations []github.Annotation, files map[string]gerrit.FileInfo, robot bool) int {
+	added := 0
+
+	for _, a := range annotations {
+		if _, ok := files[a.Path]; !ok {
+			continue
+		}
+
+		// Failures need to be fixed, notices and warnings are only hints
+		unresolved := a.Level == "failure"
+		comment := gerrit.CommentInput{
+			Line:       a.StartLine,
+			Message:    annotationMessage(a),
+			Unresolved: &unresolved,
+		}
+
+		if robot {
+			if review.RobotComments == nil {
+				review.RobotComments = make(map[string][]gerrit.RobotCommentInput)
+			}
+			review.RobotComments[a.Path] = append(review.RobotComments[a.Path], gerrit.RobotCommentInput{
+				CommentInput: comment,
+				RobotID:      a.CheckRunName,
+				RobotRunID:   strconv.FormatInt(a.CheckRunID, 10),
+				URL:          a.CheckRunURL,
+			})
+		} else {
+			if review.Comments == nil {
+				review.Comments = make(map[string][]gerrit.CommentInput)
+			}
+			review.Comments[a.Path] = append(review.Comments[a.Path], comment)
+		}
+		added++
+	}
+
+	return added
+}
+
+// annotationMessage builds the text of an inline comment,
+// e.g. "[failure] golint: exported function Foo should have comment".
+func annotationMessage(a github.Annotation) string {
+	msg := fmt.Sprintf("[%s] %s", a.Level, a.CheckRunName)
+	if len(a.Title) > 0 {
+		msg += ": " + a.Title
+	}
+	if len(a.Message) > 0 {
+		msg += "\n\n" + a.Message
+	}
+
+	return msg
+}
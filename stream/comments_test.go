@@ -0,0 +1,46 @@
+package stream
+
+import (
+	"testing"
+
+	"github.com/andygrunwald/gotrap/gerrit"
+	"github.com/andygrunwald/gotrap/github"
+)
+
+func TestInlineCommentsOnlyForFilesOfThePatchset(t *testing.T) {
+	annotations := []github.Annotation{
+		{CheckRunID: 42, CheckRunName: "lint", CheckRunURL: "https://github.com/runs/42", Path: "typo3/index.php", StartLine: 12, Level: "failure", Title: "Missing semicolon"},
+		{CheckRunID: 42, CheckRunName: "lint", Path: "typo3/unchanged.php", StartLine: 3, Level: "warning"},
+		{CheckRunID: 42, CheckRunName: "lint", Path: "typo3/index.php", StartLine: 20, Level: "notice", Message: "Consider a constant"},
+	}
+	files := map[string]gerrit.FileInfo{
+		"/COMMIT_MSG":     {},
+		"typo3/index.php": {},
+	}
+
+	review := new(gerrit.ReviewInput)
+	if added := inlineComments(review, annotations, files, false); added != 2 {
+		t.Errorf("Expected 2 comments, got %d", added)
+	}
+
+	comments := review.Comments["typo3/index.php"]
+	if len(comments) != 2 || len(review.Comments) != 1 {
+		t.Fatalf("Expected 2 comments on typo3/index.php, got %v", review.Comments)
+	}
+	if comments[0].Line != 12 || !*comments[0].Unresolved || comments[0].Message != "[failure] lint: Missing semicolon" {
+		t.Errorf("Unexpected comment %+v", comments[0])
+	}
+	if *comments[1].Unresolved || comments[1].Message != "[notice] lint\n\nConsider a constant" {
+		t.Errorf("Unexpected comment %+v", comments[1])
+	}
+
+	review = new(gerrit.ReviewInput)
+	inlineComments(review, annotations, files, true)
+	robotComments := review.RobotComments["typo3/index.php"]
+	if len(robotComments) != 2 || len(review.Comments) != 0 {
+		t.Fatalf("Expected 2 robot comments, got %v", review.RobotComments)
+	}
+	if robotComments[0].RobotID != "lint" || robotComments[0].RobotRunID != "42" || robotComments[0].URL != "https://github.com/runs/42" {
+		t.Errorf("Unexpected robot comment %+v", robotComments[0])
+	}
+}
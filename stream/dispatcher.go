@@ -0,0 +1,165 @@
+package stream
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/andygrunwald/gotrap/config"
+	"github.com/andygrunwald/gotrap/gerrit"
+	"github.com/andygrunwald/gotrap/job"
+)
+
+// handledEventTypes are the Gerrit stream events gotrap is working on.
+// See https://git.eclipse.org/r/Documentation/cmd-stream-events.html
+var handledEventTypes = map[string]bool{
+	"patchset-created":      true,
+	"wip-state-changed":     true,
+	"private-state-changed": true,
+	"comment-added":         true,
+}
+
+// dispatcher hands incoming Gerrit messages over to TakeAction.
+// It limits the number of concurrent jobs and registers every job in the job registry.
+// All jobs share one record of the handled patchsets.
+type dispatcher struct {
+	mu        sync.Mutex
+	slots     *sync.Cond
+	config    *config.Configuration
+	jobs      *job.Registry
+	patchsets *patchsetRecord
+	running   int
+	wg        sync.WaitGroup
+}
+
+func newDispatcher(c *config.Configuration, jobs *job.Registry) *dispatcher {
+	d := &dispatcher{
+		config:    c,
+		jobs:      jobs,
+		patchsets: newPatchsetRecord(),
+	}
+	d.slots = sync.NewCond(&d.mu)
+
+	return d
+}
+
+// SetConfiguration swaps the configuration used for new jobs.
+// Running jobs keep the configuration they were started with.
+// A new gotrap.concurrent applies to all jobs: Running jobs keep their slot,
+// but new jobs only start once less jobs than the new limit are running.
+func (d *dispatcher) SetConfiguration(c *config.Configuration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.config = c
+	d.slots.Broadcast()
+}
+
+// configuration returns the current configuration.
+func (d *dispatcher) configuration() *config.Configuration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.config
+}
+
+// acquire blocks until less than gotrap.concurrent jobs are running and takes a slot.
+// It returns the configuration for the new job.
+func (d *dispatcher) acquire() *config.Configuration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for d.running >= d.config.Gotrap.Concurrent {
+		d.slots.Wait()
+	}
+	d.running++
+
+	return d.config
+}
+
+// release frees the slot of a finished job.
+func (d *dispatcher) release() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.running--
+	d.slots.Broadcast()
+}
+
+// Dispatch starts working on the message m in a new go routine.
+// It blocks until a free slot is available.
+// done is called once the message was handled (or skipped).
+func (d *dispatcher) Dispatch(m gerrit.Message, done func()) {
+	c := d.configuration()
+
+	if !handledEventTypes[m.Type] {
+		log.Printf("> Skipped message (uncovered message type: %s)\n", m.Type)
+		done()
+		return
+	}
+	if reason, skip := skipMessage(c, m); skip {
+		log.Printf("> Skipped %s message (%s)\n", m.Type, reason)
+		done()
+		return
+	}
+
+	// The job stays hidden from the dashboard until it is known that the change isn`t private
+	var j *job.Job
+	if c.Gerrit.SkipPrivate {
+		j = d.jobs.AddHidden(m)
+	} else {
+		j = d.jobs.Add(m)
+	}
+
+	// Wait for a free slot
+	c = d.acquire()
+	d.wg.Add(1)
+
+	// One go routine per message
+	go func() {
+		defer func() {
+			d.release()
+			d.jobs.Done(j)
+			done()
+			d.wg.Done()
+		}()
+
+		// Build the main data structure and start working on the message :)
+		gotrap := NewGotrap(c, m, j)
+		gotrap.patchsets = d.patchsets
+		gotrap.TakeAction()
+	}()
+}
+
+// skipMessage returns true if m doesn`t need a verification:
+// wip-state-changed and private-state-changed messages are only relevant if these changes are skipped,
+// comment-added messages only if they approve the verification of an untrusted change.
+// Private changes are skipped right away, if the event tells so, to keep them out of the job registry.
+// Changes of projects and branches which aren`t configured don`t become a job either,
+// otherwise they would push the verifications out of the job history.
+// Whether the change is ready for verification now is checked with the details of the change.
+func skipMessage(c *config.Configuration, m gerrit.Message) (string, bool) {
+	switch {
+	case !c.Gerrit.HasProject(m.Change.Project):
+		return fmt.Sprintf("project %s is not configured", m.Change.Project), true
+	case !c.Gerrit.HasBranch(m.Change.Project, m.Change.Branch):
+		return fmt.Sprintf("branch %s of project %s is not configured", m.Change.Branch, m.Change.Project), true
+	case m.Change.Private && c.Gerrit.SkipPrivate:
+		return "change is private", true
+	case m.Type == "wip-state-changed" && !c.Gerrit.SkipWorkInProgress:
+		return "work-in-progress changes are not skipped", true
+	case m.Type == "private-state-changed" && !c.Gerrit.SkipPrivate:
+		return "private changes are not skipped", true
+	case m.Type == "comment-added" && !c.Gerrit.Trust.Enabled:
+		return "trust gating is disabled", true
+	case m.Type == "comment-added" && !isApprovalComment(&c.Gerrit.Trust, m):
+		return "no approval", true
+	}
+
+	return "", false
+}
+
+// Wait blocks until all dispatched messages are handled.
+func (d *dispatcher) Wait() {
+	d.wg.Wait()
+}
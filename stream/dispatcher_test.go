@@ -0,0 +1,146 @@
+package stream
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/andygrunwald/gotrap/config"
+	"github.com/andygrunwald/gotrap/gerrit"
+	"github.com/andygrunwald/gotrap/job"
+)
+
+func TestSkipMessage(t *testing.T) {
+	c := new(config.Configuration)
+	c.Gerrit.Projects = map[string]map[string]bool{"Packages/TYPO3.CMS": {"master": true, "TYPO3_6-2": false}}
+	c.Gerrit.SkipWorkInProgress = true
+
+	tests := []struct {
+		eventType string
+		skip      bool
+	}{
+		{"patchset-created", false},
+		{"wip-state-changed", false},
+		{"private-state-changed", true},
+	}
+	for _, test := range tests {
+		m := gerrit.Message{Type: test.eventType, Change: gerrit.Change{Project: "Packages/TYPO3.CMS", Branch: "master"}}
+		if _, skip := skipMessage(c, m); skip != test.skip {
+			t.Errorf("Expected %s to be skipped: %t, got %t", test.eventType, test.skip, skip)
+		}
+	}
+
+	c.Gerrit.SkipPrivate = true
+	m := gerrit.Message{Type: "patchset-created", Change: gerrit.Change{Project: "Packages/TYPO3.CMS", Branch: "master", Private: true}}
+	if reason, skip := skipMessage(c, m); !skip || reason != "change is private" {
+		t.Errorf("Expected the private change to be skipped, got %q", reason)
+	}
+
+	// Unconfigured projects and branches don`t become a job
+	for _, change := range []gerrit.Change{{Project: "Packages/Other", Branch: "master"}, {Project: "Packages/TYPO3.CMS", Branch: "TYPO3_6-2"}} {
+		if reason, skip := skipMessage(c, gerrit.Message{Type: "patchset-created", Change: change}); !skip {
+			t.Errorf("Expected %s (%s) to be skipped, got %q", change.Project, change.Branch, reason)
+		}
+	}
+}
+
+func TestVerifyPatchsetSkipsWorkInProgressChanges(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/changes/I123/" {
+			fmt.Fprint(w, `{"status": "NEW", "work_in_progress": true, "current_revision": "abc", "revisions": {"abc": {"_number": 1}}}`)
+			return
+		}
+		fmt.Fprint(w, `{}`)
+	}))
+	defer ts.Close()
+
+	c := new(config.Configuration)
+	c.Gerrit.URL = ts.URL
+	c.Gerrit.Projects = map[string]map[string]bool{"Packages/TYPO3.CMS": {}}
+	c.Gerrit.SkipWorkInProgress = true
+	m := gerrit.Message{
+		Type:     "wip-state-changed",
+		Change:   gerrit.Change{ID: "I123", Project: "Packages/TYPO3.CMS", Branch: "master"},
+		Patchset: gerrit.Patchset{Revision: "abc", Number: 1},
+	}
+	trap := NewGotrap(c, m, job.NewRegistry(0).Add(m))
+
+	if result, vote := trap.verifyPatchset(); result != "skipped: change is work in progress" || vote != nil {
+		t.Errorf("Expected the change to be skipped, got %q", result)
+	}
+}
+
+func TestVerifyPatchsetKeepsJobsOfPrivateChangesHidden(t *testing.T) {
+	private := true
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/changes/I123/" {
+			fmt.Fprintf(w, `{"status": "MERGED", "is_private": %t, "current_revision": "abc", "revisions": {"abc": {"_number": 1}}}`, private)
+			return
+		}
+		fmt.Fprint(w, `{}`)
+	}))
+	defer ts.Close()
+
+	c := new(config.Configuration)
+	c.Gerrit.URL = ts.URL
+	c.Gerrit.Projects = map[string]map[string]bool{"Packages/TYPO3.CMS": {}}
+	c.Gerrit.SkipPrivate = true
+	m := gerrit.Message{
+		Type:     "patchset-created",
+		Change:   gerrit.Change{ID: "I123", Project: "Packages/TYPO3.CMS", Branch: "master"},
+		Patchset: gerrit.Patchset{Revision: "abc", Number: 1},
+	}
+	jobs := job.NewRegistry(1)
+
+	j := jobs.AddHidden(m)
+	NewGotrap(c, m, j).verifyPatchset()
+	if !j.Hidden() {
+		t.Error("Expected the job of the private change to stay hidden")
+	}
+
+	private = false
+	j = jobs.AddHidden(m)
+	NewGotrap(c, m, j).verifyPatchset()
+	if j.Hidden() {
+		t.Error("Expected the job of the public change to be shown")
+	}
+}
+
+func TestDispatcherReloadKeepsRunningJobsInTheLimit(t *testing.T) {
+	c := new(config.Configuration)
+	c.Gotrap.Concurrent = 2
+	d := newDispatcher(c, job.NewRegistry(0))
+
+	d.acquire()
+	d.acquire()
+
+	// Lower the limit while two jobs are running
+	reloaded := new(config.Configuration)
+	reloaded.Gotrap.Concurrent = 1
+	d.SetConfiguration(reloaded)
+
+	acquired := make(chan *config.Configuration)
+	go func() {
+		acquired <- d.acquire()
+	}()
+
+	// One running job is still too much for the new limit
+	d.release()
+	select {
+	case <-acquired:
+		t.Fatal("Expected no free slot while a job is running")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	d.release()
+	select {
+	case got := <-acquired:
+		if got != reloaded {
+			t.Error("Expected the new job to get the reloaded configuration")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a free slot after all jobs finished")
+	}
+}
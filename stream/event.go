@@ -0,0 +1,70 @@
+package stream
+
+import (
+	"encoding/json"
+	"github.com/andygrunwald/gotrap/gerrit"
+	"time"
+)
+
+// eventEnvelope is the event format of the Gerrit plugin events-broker.
+// The Gerrit event is wrapped in "body".
+type eventEnvelope struct {
+	Header struct {
+		EventType      string `json:"eventType"`
+		EventCreatedOn int64  `json:"eventCreatedOn"`
+	} `json:"header"`
+	Body json.RawMessage `json:"body"`
+}
+
+// decodeEvent converts a raw event into a Gerrit message.
+// Events wrapped in the envelope of the events-broker plugin
+// are supported as well as plain Gerrit stream events.
+func decodeEvent(data []byte) (gerrit.Message, error) {
+	var change gerrit.Message
+
+	var envelope eventEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return change, err
+	}
+	if len(envelope.Body) > 0 {
+		data = envelope.Body
+	}
+
+	if err := json.Unmarshal(data, &change); err != nil {
+		return change, err
+	}
+	if len(change.Type) == 0 {
+		change.Type = envelope.Header.EventType
+	}
+
+	return change, nil
+}
+
+// eventCreatedOn returns the time a raw event was created by Gerrit.
+// It returns the zero time if the event has no timestamp.
+func eventCreatedOn(data []byte) time.Time {
+	var event struct {
+		eventEnvelope
+		EventCreatedOn int64 `json:"eventCreatedOn"`
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		return time.Time{}
+	}
+
+	createdOn := event.EventCreatedOn
+	if createdOn == 0 {
+		createdOn = event.Header.EventCreatedOn
+	}
+	if createdOn == 0 && len(event.Body) > 0 {
+		var body struct {
+			EventCreatedOn int64 `json:"eventCreatedOn"`
+		}
+		json.Unmarshal(event.Body, &body)
+		createdOn = body.EventCreatedOn
+	}
+	if createdOn == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(createdOn, 0)
+}
@@ -0,0 +1,59 @@
+package stream
+
+import (
+	"testing"
+)
+
+func TestDecodeEvent(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{
+			name: "events-broker envelope",
+			data: `{"header": {"eventId": "1", "eventType": "patchset-created", "sourceInstanceId": "gerrit"}, "body": {"type": "patchset-created", "change": {"project": "Packages/TYPO3.CMS", "branch": "master"}}}`,
+		},
+		{
+			name: "envelope without type in body",
+			data: `{"header": {"eventType": "patchset-created"}, "body": {"change": {"project": "Packages/TYPO3.CMS", "branch": "master"}}}`,
+		},
+		{
+			name: "plain stream event",
+			data: `{"type": "patchset-created", "change": {"project": "Packages/TYPO3.CMS", "branch": "master"}}`,
+		},
+	}
+
+	for _, test := range tests {
+		m, err := decodeEvent([]byte(test.data))
+		if err != nil {
+			t.Errorf("%s: Expected no error, got %s", test.name, err)
+			continue
+		}
+		if m.Type != "patchset-created" || m.Change.Project != "Packages/TYPO3.CMS" || m.Change.Branch != "master" {
+			t.Errorf("%s: Unexpected message %+v", test.name, m)
+		}
+	}
+
+	if _, err := decodeEvent([]byte(`invalid`)); err == nil {
+		t.Error("Expected an error for an invalid message")
+	}
+}
+
+func TestEventCreatedOn(t *testing.T) {
+	tests := map[string]int64{
+		`{"type": "patchset-created", "eventCreatedOn": 1488369600}`:                         1488369600,
+		`{"header": {"eventCreatedOn": 1488369601}, "body": {"type": "patchset-created"}}`:   1488369601,
+		`{"header": {}, "body": {"type": "patchset-created", "eventCreatedOn": 1488369602}}`: 1488369602,
+		`{"type": "patchset-created"}`:                                                       0,
+	}
+
+	for data, expected := range tests {
+		created := eventCreatedOn([]byte(data))
+		if expected == 0 && !created.IsZero() {
+			t.Errorf("%s: Expected no timestamp, got %s", data, created)
+		}
+		if expected > 0 && created.Unix() != expected {
+			t.Errorf("%s: Expected %d, got %d", data, expected, created.Unix())
+		}
+	}
+}
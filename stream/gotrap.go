@@ -2,10 +2,14 @@ package stream
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"github.com/andygrunwald/gotrap/config"
 	"github.com/andygrunwald/gotrap/gerrit"
 	"github.com/andygrunwald/gotrap/github"
+	"github.com/andygrunwald/gotrap/job"
+	"github.com/andygrunwald/gotrap/view"
+	gogithub "github.com/google/go-github/github"
 	"log"
 	"regexp"
 	"text/template"
@@ -15,9 +19,27 @@ type Gotrap struct {
 	githubClient github.GithubClient
 	gerritClient gerrit.GerritInstance
 	config       *config.Configuration
+	job          *job.Job
+	checks       *checksReporter
+	lastProgress string
+	groupMembers map[string][]gerrit.AccountInfo
+	patchsets    *patchsetRecord
+	started      bool
 	Message      gerrit.Message
 }
 
+// NewGotrap returns the main data structure to work on the message m.
+// The progress is reported to the job j.
+func NewGotrap(c *config.Configuration, m gerrit.Message, j *job.Job) *Gotrap {
+	return &Gotrap{
+		githubClient: *github.NewGithubClient(&c.Github),
+		gerritClient: *gerrit.NewGerritClient(&c.Gerrit),
+		config:       c,
+		job:          j,
+		Message:      m,
+	}
+}
+
 func (trap *Gotrap) TakeAction() {
 	// Stream events are documented
 	// See https://git.eclipse.org/r/Documentation/cmd-stream-events.html
@@ -25,141 +47,456 @@ func (trap *Gotrap) TakeAction() {
 	case "patchset-created":
 		log.Printf("> New patchset-created message incoming for ref \"%s\" in \"%s\" (%s)", trap.Message.Patchset.Ref, trap.Message.Change.Project, trap.Message.Change.URL)
 
-		// Check if Project is configured
-		if _, err := trap.IsProjectConfigured(trap.Message.Change.Project); err != nil {
-			log.Printf("> %s", err)
-			return
-		}
+		trap.job.Start()
+		result, vote := trap.verifyPatchset()
+		trap.finish(result, vote)
+
+	case "wip-state-changed", "private-state-changed", "comment-added":
+		// The change was skipped while it was work in progress, private
+		// or waiting for the approval of a trusted reviewer.
+		// If it is ready for review now, the patchset is verified.
+		log.Printf("> New %s message incoming for change \"%s\" in \"%s\" (%s)", trap.Message.Type, trap.Message.Change.ID, trap.Message.Change.Project, trap.Message.Change.URL)
 
-		// Check if branch is configured
-		if _, err := trap.IsBranchConfigured(trap.Message.Change.Project, trap.Message.Change.Branch); err != nil {
-			log.Printf("> %s", err)
-			return
+		trap.job.Start()
+		result, vote := trap.verifyPatchset()
+		trap.finish(result, vote)
+
+	case "change-abandoned":
+		// We have to close all PR`s
+		// change-restored
+		// change-merged
+		// ref-updated
+		// ref-replicated
+		// ref-replication-done
+		// comment-added
+		// topic-changed
+		// ....
+	default:
+		log.Printf("> Skipped AMQP message (uncovered message type: %s)\n", trap.Message.Type)
+	}
+
+	return
+}
+
+// finish finishes the job and records the outcome of a started verification.
+func (trap *Gotrap) finish(result string, vote *int) {
+	if trap.started {
+		trap.patchsets.Finish(trap.Message, vote)
+	}
+	trap.job.Finish(result, vote)
+}
+
+// verifyPatchset runs the whole pipeline for a single patchset:
+// Creating a pull request, waiting for the commit status and reporting back to Gerrit.
+// It returns a short description of the outcome and the posted vote (nil if there was no vote).
+func (trap *Gotrap) verifyPatchset() (string, *int) {
+	ctx := trap.job.Context()
+
+	// The job might be canceled while it was waiting in the queue
+	if ctx.Err() != nil {
+		return trap.abort(nil)
+	}
+
+	// Check if Project is configured
+	if _, err := trap.IsProjectConfigured(trap.Message.Change.Project); err != nil {
+		log.Printf("> %s", err)
+		return fmt.Sprintf("skipped: %s", err), nil
+	}
+
+	// Check if branch is configured
+	if _, err := trap.IsBranchConfigured(trap.Message.Change.Project, trap.Message.Change.Branch); err != nil {
+		log.Printf("> %s", err)
+		return fmt.Sprintf("skipped: %s", err), nil
+	}
+
+	// The details are available in all templates and filters from here on
+	log.Printf("> Getting details of change %s", trap.Message.Change.ID)
+	details, err := trap.gerritClient.GetChangeDetails(ctx, trap.Message.Change.ID, trap.Message.Patchset.Revision)
+	if err != nil {
+		log.Printf("> Error getting details of change %s: %s", trap.Message.Change.ID, err)
+		return fmt.Sprintf("error: %s", err), nil
+	}
+	trap.Message.Details = details
+	gerritChangeSet := details.Change
+	if !trap.config.Gerrit.SkipPrivate || !gerritChangeSet.IsPrivate {
+		trap.job.Show()
+	}
+
+	// Check if the status of the changeset is NEW and not
+	// SUBMITTED, MERGED, ABANDONED or DRAFT
+	// We only accept NEW changesets
+	if gerritChangeSet.Status != "NEW" {
+		log.Printf("> Changeset skipped, because status is \"%s\" and not \"NEW\"", gerritChangeSet.Status)
+		return fmt.Sprintf("skipped: status is %s", gerritChangeSet.Status), nil
+	}
+
+	// Work-in-progress and private changes are verified once they are ready for review
+	// (see the messages wip-state-changed and private-state-changed)
+	if trap.config.Gerrit.SkipWorkInProgress && gerritChangeSet.WorkInProgress {
+		log.Printf("> Changeset skipped, because it is work in progress")
+		trap.patchsets.Skip(trap.Message)
+		return "skipped: change is work in progress", nil
+	}
+	if trap.config.Gerrit.SkipPrivate && gerritChangeSet.IsPrivate {
+		log.Printf("> Changeset skipped, because it is private")
+		trap.patchsets.Skip(trap.Message)
+		// The public dashboard must not reveal private changes
+		trap.job.Hide()
+		return "skipped: change is private", nil
+	}
+
+	// If this revision / patchset number is not the current number
+	// we will skip this patchset-created request, because
+	// why should we create a pull request for an old patchset?
+	// The current patchset will be delivered later as message.
+	// So we won`t skip this changeset
+	if currentPatchset, _ := trap.gerritClient.IsPatchsetTheCurrentPatchset(gerritChangeSet, trap.Message.Patchset.Number); currentPatchset == false {
+		logMsg := "> Patchset skipped, because it is not the current one (patchset %d of %d, Ref: %s of %s)"
+		log.Printf(logMsg, trap.Message.Patchset.Number, gerritChangeSet.Revisions[gerritChangeSet.CurrentRevision].Number, trap.Message.Patchset.Ref, trap.Message.Change.URL)
+		return "skipped: patchset is outdated", nil
+	}
+
+	// A change which becomes ready for review again (e.g. work in progress -> ready -> work in progress -> ready)
+	// or gets another approval is only verified if its patchset wasn`t verified before.
+	// The same applies to messages a stream delivers again (e.g. after a crash).
+	// After a restart, the patchset is unknown, so the comments of gotrap on the patchset decide.
+	// The run command (without record) and dry-runs of patchset-created messages verify every patchset.
+	redelivery := trap.patchsets != nil && !trap.config.Gotrap.DryRun
+	if trap.Message.Type != "patchset-created" || redelivery {
+		state := trap.patchsets.State(trap.Message)
+		if state == patchsetRunning || state == patchsetVerified || (state == patchsetUnknown && trap.hasOwnReview(gerritChangeSet)) {
+			log.Printf("> Patchset skipped, because it was verified already")
+			return "skipped: patchset was verified already", nil
 		}
+	}
 
-		log.Printf("> Getting details of change %s", trap.Message.Change.ID)
-		gerritChangeSet, err := trap.gerritClient.GetChangeInformation(trap.Message.Change.ID)
+	// Check if change subject is excluded
+	if res, matchedPattern := trap.IsSubjectExcludedByPattern(trap.Message.Change.Subject); res == true {
+		log.Printf("> Subject \"%s\" excluded by pattern \"%s\"", trap.Message.Change.Subject, matchedPattern)
+		return fmt.Sprintf("skipped: subject excluded by pattern %s", matchedPattern), nil
+	}
+
+	// Only trusted changes run on the CI
+	if trap.config.Gerrit.Trust.Enabled {
+		trusted, reason, err := trap.checkTrust(ctx, gerritChangeSet)
 		if err != nil {
-			log.Printf("> Error getting details of change %s: %s", trap.Message.Change.ID, err)
-			return
+			log.Printf("> Error during checking the trust of change %s: %s", trap.Message.Change.ID, err)
+			return fmt.Sprintf("error: %s", err), nil
 		}
-
-		// Check if the status of the changeset is NEW and not
-		// SUBMITTED, MERGED, ABANDONED or DRAFT
-		// We only accept NEW changesets
-		if gerritChangeSet.Status != "NEW" {
-			log.Printf("> Changeset skipped, because status is \"%s\" and not \"NEW\"", gerritChangeSet.Status)
-			return
+		if !trusted {
+			log.Printf("> Changeset skipped: %s", reason)
+			return fmt.Sprintf("skipped: %s", reason), nil
 		}
+		log.Printf("> Changeset trusted: %s", reason)
+	}
 
-		// If this revision / patchset number is not the current number
-		// we will skip this patchset-created request, because
-		// why should we create a pull request for an old patchset?
-		// The current patchset will be delivered later as message.
-		// So we won`t skip this changeset
-		if currentPatchset, _ := trap.gerritClient.IsPatchsetTheCurrentPatchset(gerritChangeSet, trap.Message.Patchset.Number); currentPatchset == false {
-			logMsg := "> Patchset skipped, because it is not the current one (patchset %d of %d, Ref: %s of %s)"
-			log.Printf(logMsg, trap.Message.Patchset.Number, gerritChangeSet.Revisions[gerritChangeSet.CurrentRevision].Number, trap.Message.Patchset.Ref, trap.Message.Change.URL)
-			return
+	// Changes without relevant files (e.g. documentation only) don`t need a CI run
+	if filter, ok := trap.config.Gerrit.PathFilter(trap.Message.Change.Project, trap.Message.Change.Branch); ok {
+		path, relevant := relevantFile(filter, view.NewDetails(trap.Message.Details).Files)
+		if !relevant {
+			log.Printf("> Changeset skipped, because no file matches the path filter")
+			vote := trap.skipIrrelevantChange(ctx, filter)
+			if ctx.Err() != nil {
+				return trap.abort(nil)
+			}
+			return "skipped: no relevant files changed", vote
 		}
+		log.Printf("> File \"%s\" matches the path filter", path)
+	}
 
-		// Check if change subject is excluded
-		if res, matchedPattern := trap.IsSubjectExcludedByPattern(trap.Message.Change.Subject); res == true {
-			log.Printf("> Subject \"%s\" excluded by pattern \"%s\"", trap.Message.Change.Subject, matchedPattern)
-			return
-		}
+	// In dry-run mode we only show what we would do
+	if trap.config.Gotrap.DryRun {
+		return trap.dryRun()
+	}
 
-		// Create the pull request
-		pullRequest, err := trap.githubClient.CreatePullRequestForPatchset(&trap.Message)
-		if err != nil {
-			// If we fail to create a PR we stop here with this patchset.
-			// Without pull request no party.
-			log.Printf("> Error during creating new pull request: %s", err)
-			log.Printf("> Stopping process for the current patchset here and continue with the next one.")
-			return
+	// Several events can ask for the verification of the same patchset
+	if !trap.patchsets.Start(trap.Message) {
+		log.Printf("> Patchset skipped, because it is being verified or was verified already")
+		return "skipped: patchset is being verified or was verified already", nil
+	}
+	trap.started = true
+
+	progress := trap.config.Gerrit.Progress
+	trap.postProgress("gerrit.progress.started", progress.Started.String(), trap.newProgress(nil, nil))
+
+	// Create the pull request
+	trap.job.SetPhase(job.PhaseWaitingForBranch)
+	pullRequest, err := trap.githubClient.CreatePullRequestForPatchset(ctx, &trap.Message)
+	if err != nil {
+		if ctx.Err() != nil {
+			return trap.abort(nil)
 		}
 
-		log.Printf("> New pull request created: %s", *pullRequest.HTMLURL)
+		// If we fail to create a PR we stop here with this patchset.
+		// Without pull request no party.
+		log.Printf("> Error during creating new pull request: %s", err)
+		log.Printf("> Stopping process for the current patchset here and continue with the next one.")
+		return fmt.Sprintf("error: %s", err), nil
+	}
 
-		// Poll travis ci and wait until the PR got a status
-		s, _ := trap.githubClient.WaitUntilCommitStatusIsAvailable(*pullRequest)
+	log.Printf("> New pull request created: %s", *pullRequest.HTMLURL)
+	trap.job.SetPullRequestURL(*pullRequest.HTMLURL)
+	trap.postProgress("gerrit.progress.pull-request-created", progress.PullRequestCreated.String(), trap.newProgress(pullRequest, nil))
 
-		// Build a combined data structure for templating
-		gotrapResult := github.PullRequest{
-			PullRequest:    pullRequest,
-			CombinedStatus: s,
-		}
+	if trap.config.Gerrit.Checks.Enabled {
+		trap.checks = newChecksReporter(&trap.config.Gerrit.Checks, trap.gerritClient, trap.Message)
+		trap.checks.Schedule()
+	}
 
-		var vote int
-		// We only take care about every status except of "pending"
-		switch *s.State {
-		// Success if the latest status for all contexts is success
-		case "success":
-			vote = 0
+	// Poll travis ci and wait until the PR got a status
+	trap.job.SetPhase(job.PhaseWaitingForStatus)
+	s, err := trap.githubClient.WaitUntilCommitStatusIsAvailable(ctx, *pullRequest, func(s *gogithub.CombinedStatus) {
+		trap.onStatus(pullRequest, s)
+	})
+	if err != nil {
+		return trap.abort(pullRequest)
+	}
 
-		// Error is the 3rd party service fails
-		case "error":
-			vote = 0
+	trap.job.SetPhase(job.PhaseReporting)
 
-		// Failure if any of the contexts report as error or failure
-		case "failure":
-			vote = -1
-		}
+	// Build a combined data structure for templating
+	gotrapResult := view.Result{
+		Message:        view.NewMessage(trap.Message),
+		PullRequest:    view.NewPullRequest(pullRequest),
+		CombinedStatus: view.NewCombinedStatus(s),
+	}
 
-		// Build message to post results back to Gerrit
-		statusDetailsBuffer := new(bytes.Buffer)
-		var statusDetailsTemplate = template.Must(template.New("status-details").Parse(trap.gerritClient.Template))
-		err = statusDetailsTemplate.Execute(statusDetailsBuffer, gotrapResult)
-		if err != nil {
-			log.Println("> Error during prepare the status detail message", err)
-			return
+	var vote int
+	// We only take care about every status except of "pending"
+	switch *s.State {
+	// Success if the latest status for all contexts is success
+	case "success":
+		vote = 0
+
+	// Error is the 3rd party service fails
+	case "error":
+		vote = 0
+
+	// Failure if any of the contexts report as error or failure
+	case "failure":
+		vote = -1
+	}
+
+	// Build message to post results back to Gerrit
+	statusDetails, err := trap.renderStatusDetails(gotrapResult)
+	if err != nil {
+		log.Println("> Error during prepare the status detail message", err)
+		return fmt.Sprintf("error: %s", err), nil
+	}
+
+	// Post Command + Vote on Changeset
+	review := trap.newReview(statusDetails, *s.State)
+	review.Labels = map[string]int{
+		"Verified": vote,
+	}
+	if len(trap.config.Gerrit.InlineComments) > 0 {
+		trap.addInlineComments(ctx, review, pullRequest)
+	}
+	if err := trap.gerritClient.PostReview(ctx, &trap.Message, review); err != nil {
+		if ctx.Err() != nil {
+			return trap.abort(pullRequest)
 		}
 
-		// Post Command + Vote on Changeset
-		trap.gerritClient.PostCommentOnChangeset(&trap.Message, vote, statusDetailsBuffer.String())
+		log.Printf("> Error during posting the review: %s", err)
+		trap.closePullRequest(pullRequest)
+		return fmt.Sprintf("error: posting the review failed: %s", err), nil
+	}
 
-		// Build message to close the Pull Request
-		closeMsgBuffer := new(bytes.Buffer)
-		var closeMsgTemplate = template.Must(template.New("pull-request-close-message").Parse(trap.config.Github.PRTemplate.Close))
-		err = closeMsgTemplate.Execute(closeMsgBuffer, *trap)
-		if err != nil {
-			log.Println("> Error during prepare the pull request close message", err)
-			return
+	trap.closePullRequest(pullRequest)
+
+	return fmt.Sprintf("verified: %s", *s.State), &vote
+}
+
+// onStatus is called with every commit status fetched while waiting for the final status.
+// It keeps the job, the Gerrit checks (if enabled) and the progress messages up to date.
+func (trap *Gotrap) onStatus(pullRequest *gogithub.PullRequest, s *gogithub.CombinedStatus) {
+	trap.job.SetStatuses(jobStatuses(s))
+	if trap.checks != nil {
+		trap.checks.Report(s)
+	}
+
+	// The final status is part of the review
+	if s.GetState() == "pending" {
+		trap.postProgress("gerrit.progress.status-changed", trap.config.Gerrit.Progress.StatusChanged.String(), trap.newProgress(pullRequest, s))
+	}
+}
+
+// newReview returns a review with the message msg and the review settings
+// (tag, notification, ...) of the project. outcome (success, failure or error)
+// selects the notify setting of gerrit.review.notify-on.
+func (trap *Gotrap) newReview(msg, outcome string) *gerrit.ReviewInput {
+	settings := trap.config.Gerrit.ReviewSettings(trap.Message.Change.Project)
+
+	review := &gerrit.ReviewInput{
+		Message:               msg,
+		Tag:                   settings.Tag,
+		Notify:                settings.Notify,
+		OmitDuplicateComments: settings.OmitDuplicateComments,
+	}
+	if notify, ok := settings.NotifyOn[outcome]; ok {
+		review.Notify = notify
+	}
+	if len(settings.NotifyDetails) > 0 {
+		review.NotifyDetails = make(map[string]gerrit.NotifyInfo, len(settings.NotifyDetails))
+		for recipientType, accounts := range settings.NotifyDetails {
+			review.NotifyDetails[recipientType] = gerrit.NotifyInfo{Accounts: accounts}
 		}
+	}
 
-		_, err = trap.githubClient.AddCommentToPullRequest(pullRequest, closeMsgBuffer.String())
-		if err != nil {
-			log.Printf("> Error during adding a comment to a pull request %s: %s", *pullRequest.HTMLURL, err)
-		} else {
-			log.Printf("> Comment added to pull request: %s", *pullRequest.HTMLURL)
+	return review
+}
+
+// dryRun logs what would happen with the patchset without writing anything to Gerrit or Github.
+// The templates for the pull request and the Gerrit comment are rendered with placeholder data,
+// because without a pull request there is no commit status.
+func (trap *Gotrap) dryRun() (string, *int) {
+	title, body, err := trap.githubClient.RenderPullRequest(&trap.Message)
+	if err != nil {
+		log.Printf("> [dry-run] Error during rendering the pull request: %s", err)
+		return fmt.Sprintf("error: %s", err), nil
+	}
+	log.Printf("> [dry-run] Would create pull request %s -> %s in %s/%s", trap.Message.Patchset.Ref, trap.Message.Change.Branch, trap.config.Github.Organisation, trap.config.Github.Repository)
+	log.Printf("> [dry-run] Pull request title: %s", title)
+	log.Printf("> [dry-run] Pull request body:\n%s", body)
+
+	placeholderPullRequest := view.PullRequest{
+		Title:   title,
+		HTMLURL: "https://github.com/" + trap.config.Github.Organisation + "/" + trap.config.Github.Repository + "/pull/0",
+		State:   "open",
+	}
+	statusDetails, err := trap.renderStatusDetails(view.Result{
+		Message:        view.NewMessage(trap.Message),
+		PullRequest:    placeholderPullRequest,
+		CombinedStatus: view.CombinedStatus{State: "success"},
+	})
+	if err != nil {
+		log.Printf("> [dry-run] Error during rendering the status detail message: %s", err)
+		return fmt.Sprintf("error: %s", err), nil
+	}
+	log.Printf("> [dry-run] Would vote Verified=0 (success or error) or Verified=-1 (failure) on %s with message:\n%s", trap.Message.Change.URL, statusDetails)
+
+	closeMessage, err := trap.renderCloseMessage(placeholderPullRequest)
+	if err != nil {
+		log.Printf("> [dry-run] Error during rendering the pull request close message: %s", err)
+		return fmt.Sprintf("error: %s", err), nil
+	}
+	log.Printf("> [dry-run] Would close the pull request with comment:\n%s", closeMessage)
+
+	return "dry-run: would create pull request", nil
+}
+
+// renderStatusDetails renders the Gerrit comment with the results of the pull request.
+func (trap *Gotrap) renderStatusDetails(result view.Result) (string, error) {
+	statusDetailsBuffer := new(bytes.Buffer)
+	var statusDetailsTemplate = template.Must(template.New("status-details").Parse(trap.gerritClient.Template))
+	err := statusDetailsTemplate.Execute(statusDetailsBuffer, result)
+
+	return statusDetailsBuffer.String(), err
+}
+
+// renderCloseMessage renders the comment which is added to the pull request before closing it.
+func (trap *Gotrap) renderCloseMessage(pullRequest view.PullRequest) (string, error) {
+	data := view.Close{
+		Message:     view.NewMessage(trap.Message),
+		PullRequest: pullRequest,
+	}
+
+	closeMsgBuffer := new(bytes.Buffer)
+	var closeMsgTemplate = template.Must(template.New("pull-request-close-message").Parse(trap.config.Github.PRTemplate.Close))
+	err := closeMsgTemplate.Execute(closeMsgBuffer, data)
+
+	return closeMsgBuffer.String(), err
+}
+
+// abort stops a job which was canceled or force-finished by an operator.
+// If the job was force-finished, the requested vote will be posted to Gerrit.
+// An already created pull request will be closed.
+func (trap *Gotrap) abort(pullRequest *gogithub.PullRequest) (string, *int) {
+	result := "canceled by operator"
+	var postedVote *int
+
+	if vote, msg, forced := trap.job.ForcedVote(); forced {
+		if len(msg) == 0 {
+			msg = "The verification was finished by an operator."
 		}
+		log.Printf("> Job %d force-finished by operator with vote %d", trap.job.ID(), vote)
+		result = "force-finished by operator"
+		postedVote = &vote
 
-		_, err = trap.githubClient.ClosePullRequest(pullRequest)
-		if err != nil {
-			log.Printf("> Error during closing a pull request %s: %s", *pullRequest.HTMLURL, err)
+		if trap.config.Gotrap.DryRun {
+			log.Printf("> [dry-run] Would vote Verified=%d on %s with message:\n%s", vote, trap.Message.Change.URL, msg)
 		} else {
-			log.Printf("> Pull request closed: %s", *pullRequest.HTMLURL)
+			outcome := "success"
+			if vote < 0 {
+				outcome = "failure"
+			}
+			review := trap.newReview(msg, outcome)
+			review.Labels = map[string]int{
+				"Verified": vote,
+			}
+			// The job context is already canceled
+			if err := trap.gerritClient.PostReview(context.Background(), &trap.Message, review); err != nil {
+				log.Printf("> Error during posting the review: %s", err)
+				result = fmt.Sprintf("error: posting the review failed: %s", err)
+				postedVote = nil
+			}
 		}
+	} else {
+		log.Printf("> Job %d canceled by operator", trap.job.ID())
+	}
 
-	case "change-abandoned":
-		// We have to close all PR`s
-		// change-restored
-		// change-merged
-		// ref-updated
-		// ref-replicated
-		// ref-replication-done
-		// comment-added
-		// topic-changed
-		// ....
-	default:
-		log.Printf("> Skipped AMQP message (uncovered message type: %s)\n", trap.Message.Type)
+	if trap.checks != nil {
+		trap.checks.Abort("The verification was " + result + ".")
 	}
 
-	return
+	if pullRequest != nil {
+		trap.closePullRequest(pullRequest)
+	}
+
+	return result, postedVote
+}
+
+// closePullRequest adds the close message to the pull request and closes it afterwards.
+func (trap *Gotrap) closePullRequest(pullRequest *gogithub.PullRequest) {
+	// Build message to close the Pull Request
+	closeMessage, err := trap.renderCloseMessage(view.NewPullRequest(pullRequest))
+	if err != nil {
+		log.Println("> Error during prepare the pull request close message", err)
+		return
+	}
+
+	_, err = trap.githubClient.AddCommentToPullRequest(pullRequest, closeMessage)
+	if err != nil {
+		log.Printf("> Error during adding a comment to a pull request %s: %s", *pullRequest.HTMLURL, err)
+	} else {
+		log.Printf("> Comment added to pull request: %s", *pullRequest.HTMLURL)
+	}
+
+	_, err = trap.githubClient.ClosePullRequest(pullRequest)
+	if err != nil {
+		log.Printf("> Error during closing a pull request %s: %s", *pullRequest.HTMLURL, err)
+	} else {
+		log.Printf("> Pull request closed: %s", *pullRequest.HTMLURL)
+	}
+}
+
+// jobStatuses converts the combined status of a pull request into the statuses of a job.
+func jobStatuses(s *gogithub.CombinedStatus) []job.Status {
+	statuses := make([]job.Status, 0, len(s.Statuses))
+	for _, status := range s.Statuses {
+		statuses = append(statuses, job.Status{
+			Context:     status.GetContext(),
+			State:       status.GetState(),
+			Description: status.GetDescription(),
+			TargetURL:   status.GetTargetURL(),
+		})
+	}
+
+	return statuses
 }
 
 func (trap *Gotrap) IsProjectConfigured(project string) (bool, error) {
-	if _, ok := trap.config.Gerrit.Projects[project]; !ok {
+	if !trap.config.Gerrit.HasProject(project) {
 		return false, fmt.Errorf("Project \"%s\" is not configured", project)
 	}
 
@@ -168,16 +505,11 @@ func (trap *Gotrap) IsProjectConfigured(project string) (bool, error) {
 
 func (trap *Gotrap) IsBranchConfigured(project, branch string) (bool, error) {
 	// If no branch is configured, we assume that all branches should be covered
-	if len(trap.config.Gerrit.Projects[project]) == 0 {
-		return true, nil
-	}
-
-	// If the branch exists and is configured as true, then it is valid configured
-	if val, ok := trap.config.Gerrit.Projects[project][branch]; ok && val == true {
-		return true, nil
+	if !trap.config.Gerrit.HasBranch(project, branch) {
+		return false, fmt.Errorf("Branch \"%s\" not configured for project \"%s\"", branch, project)
 	}
 
-	return false, fmt.Errorf("Branch \"%s\" not configured for project \"%s\"", branch, project)
+	return true, nil
 }
 
 func (trap *Gotrap) IsSubjectExcludedByPattern(subject string) (bool, string) {
@@ -0,0 +1,276 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"github.com/andygrunwald/gotrap/backoff"
+	"github.com/andygrunwald/gotrap/config"
+	"github.com/andygrunwald/gotrap/job"
+	"github.com/segmentio/kafka-go"
+	"log"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// KafkaStream consumes Gerrit events from a Kafka topic,
+// like the ones published by the Gerrit plugin events-broker / kafka-events.
+// The topic is consumed with a consumer group. The offset of a message
+// is committed after the message was handled.
+type KafkaStream struct {
+	Config *config.Configuration
+
+	mu         sync.Mutex
+	reconnect  context.CancelFunc
+	dispatcher *dispatcher
+	backoff    backoff.Backoff
+	ctx        context.Context
+	cancel     context.CancelFunc
+}
+
+func init() {
+	Streams[StreamKafka] = new(KafkaStream)
+}
+
+func (s *KafkaStream) Initialize(config *config.Configuration, jobs *job.Registry) {
+	s.Config = config
+	s.dispatcher = newDispatcher(config, jobs)
+	s.backoff = backoff.Default
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+}
+
+// Reload swaps the configuration used for new jobs.
+// Running jobs finish with the configuration they were started with.
+// If the Kafka settings changed, gotrap reconnects to the Kafka brokers
+// once the running jobs committed their offsets.
+func (s *KafkaStream) Reload(c *config.Configuration) {
+	s.mu.Lock()
+	old := s.Config
+	s.Config = c
+	reconnect := s.reconnect
+	s.mu.Unlock()
+
+	s.dispatcher.SetConfiguration(c)
+
+	if !reflect.DeepEqual(old.Kafka, c.Kafka) && reconnect != nil {
+		log.Println("> Kafka settings changed. Reconnecting to the Kafka brokers.")
+		reconnect()
+	}
+}
+
+// configuration returns the current configuration.
+func (s *KafkaStream) configuration() *config.Configuration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.Config
+}
+
+// kafkaReader is the part of kafka.Reader used by the stream.
+type kafkaReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// Start consumes messages from Kafka until Stop is called.
+// If reading from Kafka fails, gotrap reconnects with an exponential backoff.
+func (s *KafkaStream) Start() error {
+	return s.run(s.newReader)
+}
+
+// run consumes messages of the readers returned by open until Stop is called.
+// A reader is only closed after the running jobs committed their offsets with it.
+// Otherwise Kafka would deliver their messages again.
+func (s *KafkaStream) run(open func() (kafkaReader, error)) error {
+	attempt := 0
+
+	for {
+		reader, err := open()
+		if err != nil {
+			return err
+		}
+		log.Println("> Connected to Kafka. Waiting for messages.")
+
+		ctx, reconnect := context.WithCancel(s.ctx)
+		s.mu.Lock()
+		s.reconnect = reconnect
+		s.mu.Unlock()
+
+		err = s.consume(ctx, reader)
+		reloaded := ctx.Err() != nil
+		reconnect()
+		switch {
+		case s.ctx.Err() != nil:
+			// Offsets can only be committed as long as the reader is open
+			s.dispatcher.Wait()
+			return reader.Close()
+
+		case reloaded:
+			// The Kafka settings changed during a reload
+			s.dispatcher.Wait()
+			reader.Close()
+			attempt = 0
+			continue
+
+		default:
+			s.dispatcher.Wait()
+			reader.Close()
+			delay := s.backoff.Duration(attempt)
+			attempt++
+			log.Printf("> Reading from Kafka failed (attempt %d): %s. Next try in %s", attempt, err, delay)
+
+			select {
+			case <-time.After(delay):
+			case <-s.ctx.Done():
+				return nil
+			}
+		}
+	}
+}
+
+// Stop stops consuming messages.
+// Start returns after all running jobs are finished.
+func (s *KafkaStream) Stop() {
+	s.cancel()
+}
+
+// newReader creates a Kafka reader for the consumer group of gotrap.
+func (s *KafkaStream) newReader() (kafkaReader, error) {
+	c := s.configuration().Kafka
+
+	readerConfig := kafka.ReaderConfig{
+		Brokers: c.Brokers,
+		Topic:   c.Topic,
+		GroupID: c.GroupID,
+		// Without a committed offset, the consumer group starts at the end of the topic
+		StartOffset: kafka.LastOffset,
+	}
+	if c.StartOffset == "first" {
+		readerConfig.StartOffset = kafka.FirstOffset
+	}
+	if err := readerConfig.Validate(); err != nil {
+		return nil, err
+	}
+
+	return kafka.NewReader(readerConfig), nil
+}
+
+// consume hands over all messages of reader to the dispatcher until reading fails or ctx is canceled.
+func (s *KafkaStream) consume(ctx context.Context, reader kafkaReader) error {
+	offsets := newOffsetTracker()
+
+	for {
+		message, err := reader.FetchMessage(ctx)
+		if err != nil {
+			return err
+		}
+
+		s.handle(reader, offsets, message)
+	}
+}
+
+// handle converts the Kafka message into a Gerrit message and dispatches it.
+// The offset is committed once the message and all messages
+// before it (of the same partition) were handled.
+func (s *KafkaStream) handle(reader kafkaReader, offsets *offsetTracker, message kafka.Message) {
+	tracked := offsets.Add(message)
+	commit := func() {
+		m, ok := offsets.Done(tracked)
+		if !ok {
+			return
+		}
+		// Use an own context, because running jobs should commit their offset during shutdown as well
+		if err := reader.CommitMessages(context.Background(), m); err != nil {
+			log.Printf("> Committing Kafka offset %d (partition %d) failed: %s", m.Offset, m.Partition, err)
+		}
+	}
+
+	change, err := decodeEvent(message.Value)
+	// If we can`t read the message, we will skip it
+	if err != nil {
+		log.Printf("> Skipped Kafka message, because it can`t be read: %s", err)
+		commit()
+		return
+	}
+
+	s.dispatcher.Dispatch(change, commit)
+}
+
+// VerifyCredentials checks if one of the Kafka brokers is reachable
+// and knows the configured topic.
+func (s *KafkaStream) VerifyCredentials() error {
+	c := s.configuration().Kafka
+	dialer := &kafka.Dialer{Timeout: 10 * time.Second}
+
+	err := errors.New("No Kafka broker configured")
+	for _, broker := range c.Brokers {
+		var conn *kafka.Conn
+		conn, err = dialer.Dial("tcp", broker)
+		if err != nil {
+			continue
+		}
+
+		_, err = conn.ReadPartitions(c.Topic)
+		conn.Close()
+		if err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
+
+// offsetTracker keeps track of the fetched Kafka messages per partition.
+// Kafka stores one offset per partition and committing an offset marks all
+// messages before it as consumed. Messages are handled concurrently and can finish
+// in any order. Only the latest message without unfinished predecessors can be committed.
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[int][]*trackedMessage
+}
+
+type trackedMessage struct {
+	message kafka.Message
+	done    bool
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{
+		partitions: make(map[int][]*trackedMessage),
+	}
+}
+
+// Add registers a fetched message.
+// Messages of a partition need to be added in the order they were fetched.
+func (t *offsetTracker) Add(m kafka.Message) *trackedMessage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tracked := &trackedMessage{message: m}
+	t.partitions[m.Partition] = append(t.partitions[m.Partition], tracked)
+
+	return tracked
+}
+
+// Done marks the message as handled.
+// It returns the message whose offset can be committed, if any.
+func (t *offsetTracker) Done(tracked *trackedMessage) (kafka.Message, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tracked.done = true
+
+	var commit kafka.Message
+	found := false
+
+	queue := t.partitions[tracked.message.Partition]
+	for len(queue) > 0 && queue[0].done {
+		commit = queue[0].message
+		found = true
+		queue = queue[1:]
+	}
+	t.partitions[tracked.message.Partition] = queue
+
+	return commit, found
+}
@@ -0,0 +1,143 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andygrunwald/gotrap/backoff"
+	"github.com/andygrunwald/gotrap/config"
+	"github.com/andygrunwald/gotrap/job"
+	"github.com/segmentio/kafka-go"
+)
+
+// fakeKafkaReader returns its messages and the error afterwards.
+// Without error, it blocks until the context is canceled.
+// Commits and closing are recorded in events.
+type fakeKafkaReader struct {
+	mu       sync.Mutex
+	messages []kafka.Message
+	err      error
+	failed   chan struct{}
+	events   *[]string
+}
+
+func (r *fakeKafkaReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	r.mu.Lock()
+	if len(r.messages) > 0 {
+		m := r.messages[0]
+		r.messages = r.messages[1:]
+		r.mu.Unlock()
+		return m, nil
+	}
+	r.mu.Unlock()
+
+	if r.err != nil {
+		close(r.failed)
+		return kafka.Message{}, r.err
+	}
+	<-ctx.Done()
+	return kafka.Message{}, ctx.Err()
+}
+
+func (r *fakeKafkaReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	r.record(fmt.Sprintf("commit %d", msgs[len(msgs)-1].Offset))
+	return nil
+}
+
+func (r *fakeKafkaReader) Close() error {
+	r.record("close")
+	return nil
+}
+
+func (r *fakeKafkaReader) record(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	*r.events = append(*r.events, event)
+}
+
+func TestOffsetTrackerCommitsOnlyFinishedPrefix(t *testing.T) {
+	offsets := newOffsetTracker()
+
+	first := offsets.Add(kafka.Message{Partition: 0, Offset: 10})
+	second := offsets.Add(kafka.Message{Partition: 0, Offset: 11})
+	third := offsets.Add(kafka.Message{Partition: 0, Offset: 12})
+	other := offsets.Add(kafka.Message{Partition: 1, Offset: 5})
+
+	// The second message finishes first. Its offset can`t be committed,
+	// because this would mark the first message as consumed as well.
+	if m, ok := offsets.Done(second); ok {
+		t.Errorf("Expected no commit, got offset %d", m.Offset)
+	}
+
+	if m, ok := offsets.Done(first); !ok || m.Offset != 11 {
+		t.Errorf("Expected commit of offset 11, got %d (%t)", m.Offset, ok)
+	}
+
+	if m, ok := offsets.Done(other); !ok || m.Partition != 1 || m.Offset != 5 {
+		t.Errorf("Expected commit of offset 5 in partition 1, got %d in partition %d (%t)", m.Offset, m.Partition, ok)
+	}
+
+	if m, ok := offsets.Done(third); !ok || m.Offset != 12 {
+		t.Errorf("Expected commit of offset 12, got %d (%t)", m.Offset, ok)
+	}
+}
+
+func TestKafkaReaderIsClosedAfterRunningJobsOnReadErrors(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The job keeps running until the test releases it
+		<-release
+		fmt.Fprint(w, `{"status": "MERGED"}`)
+	}))
+	defer ts.Close()
+
+	c := new(config.Configuration)
+	c.Gotrap.Concurrent = 1
+	c.Gerrit.URL = ts.URL
+	c.Gerrit.Projects = map[string]map[string]bool{"Packages/TYPO3.CMS": {}}
+
+	s := new(KafkaStream)
+	s.Initialize(c, job.NewRegistry(0))
+	s.backoff = backoff.Backoff{Initial: time.Millisecond, Max: time.Millisecond, Multiplier: 2}
+
+	var events []string
+	first := &fakeKafkaReader{
+		messages: []kafka.Message{{Offset: 7, Value: []byte(`{"type": "patchset-created", "change": {"project": "Packages/TYPO3.CMS", "branch": "master", "id": "I123"}, "patchSet": {"number": "1"}}`)}},
+		err:      errors.New("broker not available"),
+		failed:   make(chan struct{}),
+		events:   &events,
+	}
+	second := &fakeKafkaReader{events: &events}
+	readers := []kafkaReader{first, second}
+	open := func() (kafkaReader, error) {
+		r := readers[0]
+		readers = readers[1:]
+		return r, nil
+	}
+
+	result := make(chan error)
+	go func() {
+		result <- s.run(open)
+	}()
+
+	waitFor(t, first.failed, "the read error")
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	time.Sleep(20 * time.Millisecond)
+	s.Stop()
+	if err := <-result; err != nil {
+		t.Errorf("Expected no error, got %s", err)
+	}
+
+	if len(events) != 3 || events[0] != "commit 7" || events[1] != "close" {
+		t.Errorf("Expected the offset to be committed before the reader was closed, got %v", events)
+	}
+}
@@ -0,0 +1,144 @@
+package stream
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/andygrunwald/gotrap/gerrit"
+)
+
+// patchsetRecordSize is the number of patchsets a patchsetRecord remembers.
+const patchsetRecordSize = 1000
+
+type patchsetState int
+
+const (
+	patchsetUnknown patchsetState = iota
+	// patchsetSkipped means the patchset was skipped, because the change was work in progress or private
+	patchsetSkipped
+	// patchsetRunning means the patchset is being verified right now
+	patchsetRunning
+	// patchsetVerified means a vote was posted on the patchset
+	patchsetVerified
+)
+
+// patchsetRecord remembers the state of the last handled patchsets.
+// It prevents a second verification of a patchset, e.g. if a work-in-progress change
+// becomes ready for review again or another reviewer approves an untrusted change.
+// The record is kept in memory only. The oldest patchsets are forgotten first.
+// A nil record remembers nothing.
+type patchsetRecord struct {
+	mu     sync.Mutex
+	states map[string]patchsetState
+	order  []string
+}
+
+func newPatchsetRecord() *patchsetRecord {
+	return &patchsetRecord{
+		states: make(map[string]patchsetState),
+	}
+}
+
+// State returns the recorded state of the patchset of m.
+func (r *patchsetRecord) State(m gerrit.Message) patchsetState {
+	if r == nil {
+		return patchsetUnknown
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.states[patchsetKey(m)]
+}
+
+// Skip records that the patchset of m was skipped.
+func (r *patchsetRecord) Skip(m gerrit.Message) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.states[patchsetKey(m)] == patchsetUnknown {
+		r.set(patchsetKey(m), patchsetSkipped)
+	}
+}
+
+// Start records that the verification of the patchset of m starts.
+// It returns false, if the patchset is running or verified already.
+func (r *patchsetRecord) Start(m gerrit.Message) bool {
+	if r == nil {
+		return true
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch r.states[patchsetKey(m)] {
+	case patchsetRunning, patchsetVerified:
+		return false
+	}
+	r.set(patchsetKey(m), patchsetRunning)
+
+	return true
+}
+
+// Finish records the end of a verification started with Start.
+// Without vote (e.g. after an error), the patchset can be verified again.
+func (r *patchsetRecord) Finish(m gerrit.Message, vote *int) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if vote != nil {
+		r.set(patchsetKey(m), patchsetVerified)
+	} else {
+		r.set(patchsetKey(m), patchsetUnknown)
+	}
+}
+
+// set changes the state of key and forgets the oldest patchsets if the record is full.
+// The lock has to be held by the caller.
+func (r *patchsetRecord) set(key string, state patchsetState) {
+	if _, ok := r.states[key]; !ok {
+		r.order = append(r.order, key)
+	}
+	r.states[key] = state
+
+	for len(r.order) > patchsetRecordSize {
+		delete(r.states, r.order[0])
+		r.order = r.order[1:]
+	}
+}
+
+// patchsetKey identifies a patchset. A Change-Id can be used in several branches and projects.
+func patchsetKey(m gerrit.Message) string {
+	return fmt.Sprintf("%s~%s~%s/%d", m.Change.Project, m.Change.Branch, m.Change.ID, m.Patchset.Number)
+}
+
+// hasOwnReview returns true if gotrap commented on the current patchset of change already
+// (with a vote, a progress message or a skip message).
+// A comment is recognized by the review tag or by the account gotrap uses for Gerrit.
+// It is used after a restart, when the record doesn`t know the patchset.
+func (trap *Gotrap) hasOwnReview(change *gerrit.ChangeInfo) bool {
+	tag := trap.config.Gerrit.ReviewSettings(trap.Message.Change.Project).Tag
+	username := trap.config.Gerrit.Username
+	if trap.config.Gerrit.SSH.Enabled && len(trap.config.Gerrit.SSH.Username) > 0 {
+		username = trap.config.Gerrit.SSH.Username
+	}
+	current := change.Revisions[change.CurrentRevision].Number
+
+	for _, message := range change.Messages {
+		if message.RevisionNumber != current {
+			continue
+		}
+		if len(tag) > 0 && message.Tag == tag {
+			return true
+		}
+		if len(username) > 0 && message.Author != nil && message.Author.Username == username {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,106 @@
+package stream
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andygrunwald/gotrap/config"
+	"github.com/andygrunwald/gotrap/gerrit"
+	"github.com/andygrunwald/gotrap/job"
+)
+
+func TestPatchsetRecord(t *testing.T) {
+	r := newPatchsetRecord()
+	m := gerrit.Message{Change: gerrit.Change{ID: "I123"}, Patchset: gerrit.Patchset{Number: 1}}
+
+	r.Skip(m)
+	if state := r.State(m); state != patchsetSkipped {
+		t.Errorf("Expected a skipped patchset, got %d", state)
+	}
+	if !r.Start(m) {
+		t.Fatal("Expected a skipped patchset to be started")
+	}
+	if r.Start(m) {
+		t.Error("Expected a running patchset not to be started twice")
+	}
+
+	// Without a vote, the patchset can be verified again
+	r.Finish(m, nil)
+	if !r.Start(m) {
+		t.Fatal("Expected a patchset without a vote to be started again")
+	}
+	vote := -1
+	r.Finish(m, &vote)
+	r.Skip(m)
+	if state := r.State(m); state != patchsetVerified {
+		t.Errorf("Expected a verified patchset, got %d", state)
+	}
+
+	// Other patchsets of the change are not affected
+	m.Patchset.Number = 2
+	if state := r.State(m); state != patchsetUnknown {
+		t.Errorf("Expected an unknown patchset, got %d", state)
+	}
+}
+
+func TestPatchsetRecordForgetsOldestPatchsets(t *testing.T) {
+	r := newPatchsetRecord()
+	for i := 0; i <= patchsetRecordSize; i++ {
+		r.Skip(gerrit.Message{Change: gerrit.Change{ID: "I123"}, Patchset: gerrit.Patchset{Number: uint(i)}})
+	}
+
+	if state := r.State(gerrit.Message{Change: gerrit.Change{ID: "I123"}, Patchset: gerrit.Patchset{Number: 0}}); state != patchsetUnknown {
+		t.Errorf("Expected the oldest patchset to be forgotten, got %d", state)
+	}
+	if len(r.states) != patchsetRecordSize {
+		t.Errorf("Expected %d patchsets, got %d", patchsetRecordSize, len(r.states))
+	}
+}
+
+func TestVerifyPatchsetSkipsReadyChangesWhichWereVerified(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/changes/I123/" {
+			fmt.Fprint(w, `{"status": "NEW", "current_revision": "abc", "revisions": {"abc": {"_number": 1}},
+				"messages": [{"tag": "autogenerated:gotrap", "_revision_number": 1, "message": "Patch Set 1: Verified-1"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{}`)
+	}))
+	defer ts.Close()
+
+	c := new(config.Configuration)
+	c.Gerrit.URL = ts.URL
+	c.Gerrit.Projects = map[string]map[string]bool{"Packages/TYPO3.CMS": {}}
+	c.Gerrit.SkipWorkInProgress = true
+	c.Gerrit.Review.Tag = "autogenerated:gotrap"
+	c.Gotrap.DryRun = true
+	m := gerrit.Message{
+		Type:     "wip-state-changed",
+		Change:   gerrit.Change{ID: "I123", Project: "Packages/TYPO3.CMS", Branch: "master"},
+		Patchset: gerrit.Patchset{Revision: "abc", Number: 1},
+	}
+
+	// After a restart, the comment of gotrap on the patchset is the only hint
+	trap := NewGotrap(c, m, job.NewRegistry(0).Add(m))
+	if result, _ := trap.verifyPatchset(); result != "skipped: patchset was verified already" {
+		t.Errorf("Expected the patchset to be skipped, got %q", result)
+	}
+
+	// A patchset skipped while the change was work in progress is verified
+	trap = NewGotrap(c, m, job.NewRegistry(0).Add(m))
+	trap.patchsets = newPatchsetRecord()
+	trap.patchsets.Skip(m)
+	if result, _ := trap.verifyPatchset(); result != "dry-run: would create pull request" {
+		t.Errorf("Expected the skipped patchset to be verified, got %q", result)
+	}
+	// A patchset-created message delivered again after a crash
+	c.Gotrap.DryRun = false
+	m.Type = "patchset-created"
+	trap = NewGotrap(c, m, job.NewRegistry(0).Add(m))
+	trap.patchsets = newPatchsetRecord()
+	if result, _ := trap.verifyPatchset(); result != "skipped: patchset was verified already" {
+		t.Errorf("Expected the delivered patchset to be skipped, got %q", result)
+	}
+}
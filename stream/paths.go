@@ -0,0 +1,132 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"github.com/andygrunwald/gotrap/config"
+	"github.com/andygrunwald/gotrap/view"
+	"log"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// relevantFile returns the first file which matches the path filter, or false if there is none.
+// A file matches if it matches one of the include globs (or no include globs are configured)
+// and none of the exclude globs. Renamed files match with their old path as well.
+// A patchset without files (e.g. only the commit message changed) is relevant, because nothing can be filtered.
+func relevantFile(filter config.GerritPathFilterConfiguration, files []view.File) (string, bool) {
+	if len(files) == 0 {
+		return "", true
+	}
+
+	includes := compileGlobs(filter.Include)
+	excludes := compileGlobs(filter.Exclude)
+
+	for _, f := range files {
+		for _, path := range []string{f.Path, f.OldPath} {
+			if len(path) == 0 {
+				continue
+			}
+			if (len(includes) == 0 || matchesAny(includes, path)) && !matchesAny(excludes, path) {
+				return path, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// skipIrrelevantChange posts the skip message and vote of filter on the change,
+// because none of its files is relevant for the CI.
+// Without skip message and vote, nothing is posted.
+// In dry-run mode, the message and vote are only logged.
+// It returns the posted vote (nil if no vote was posted).
+func (trap *Gotrap) skipIrrelevantChange(ctx context.Context, filter config.GerritPathFilterConfiguration) *int {
+	text := filter.SkipMessage.String()
+	if len(strings.TrimSpace(text)) == 0 && filter.SkipVote == nil {
+		return nil
+	}
+
+	skipTemplate, err := template.New("skip-message").Parse(text)
+	if err != nil {
+		log.Printf("> Error during parsing the skip message: %s", err)
+		return nil
+	}
+	msgBuffer := new(bytes.Buffer)
+	if err := skipTemplate.Execute(msgBuffer, view.NewMessage(trap.Message)); err != nil {
+		log.Printf("> Error during rendering the skip message: %s", err)
+		return nil
+	}
+
+	if trap.config.Gotrap.DryRun {
+		if filter.SkipVote != nil {
+			log.Printf("> [dry-run] Would vote Verified=%d on %s with skip message:\n%s", *filter.SkipVote, trap.Message.Change.URL, msgBuffer.String())
+		} else {
+			log.Printf("> [dry-run] Would post skip message on %s:\n%s", trap.Message.Change.URL, msgBuffer.String())
+		}
+		return nil
+	}
+
+	review := trap.newReview(msgBuffer.String(), "")
+	if filter.SkipVote != nil {
+		review.Labels = map[string]int{
+			"Verified": *filter.SkipVote,
+		}
+	}
+	if err := trap.gerritClient.PostReview(ctx, &trap.Message, review); err != nil {
+		log.Printf("> Error during posting the skip message: %s", err)
+		return nil
+	}
+
+	return filter.SkipVote
+}
+
+// compileGlobs converts the glob patterns into regular expressions.
+func compileGlobs(patterns []string) []*regexp.Regexp {
+	globs := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		globs = append(globs, globRegexp(pattern))
+	}
+
+	return globs
+}
+
+// globRegexp converts a glob pattern into a regular expression.
+// "*" matches everything except "/", "**" matches everything including "/",
+// "**/" matches zero or more directories and "?" matches a single character except "/".
+// Examples: "Documentation/**", "**/*.md", "typo3/sysext/*/Classes/**"
+func globRegexp(pattern string) *regexp.Regexp {
+	var expr bytes.Buffer
+	expr.WriteString("^")
+
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			expr.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			expr.WriteString("[^/]*")
+		case pattern[i] == '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	expr.WriteString("$")
+
+	return regexp.MustCompile(expr.String())
+}
+
+func matchesAny(globs []*regexp.Regexp, path string) bool {
+	for _, glob := range globs {
+		if glob.MatchString(path) {
+			return true
+		}
+	}
+
+	return false
+}
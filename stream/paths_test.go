@@ -0,0 +1,158 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andygrunwald/gotrap/config"
+	"github.com/andygrunwald/gotrap/gerrit"
+	"github.com/andygrunwald/gotrap/job"
+	"github.com/andygrunwald/gotrap/view"
+)
+
+func TestGlobRegexp(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		path     string
+		expected bool
+	}{
+		{"**/*.md", "README.md", true},
+		{"**/*.md", "typo3/sysext/core/README.md", true},
+		{"*.md", "typo3/sysext/core/README.md", false},
+		{"Documentation/**", "Documentation/Index.rst", true},
+		{"Documentation/**", "typo3/Documentation/Index.rst", false},
+		{"typo3/sysext/*/Classes/**", "typo3/sysext/fluid/Classes/ViewHelper.php", true},
+		{"typo3/sysext/*/Classes/**", "typo3/sysext/fluid/Tests/ViewHelperTest.php", false},
+		{"composer.???n", "composer.json", true},
+		{"composer.json", "composerXjson", false},
+	}
+	for _, test := range tests {
+		if matched := globRegexp(test.pattern).MatchString(test.path); matched != test.expected {
+			t.Errorf("Expected %s to match %s: %t, got %t", test.pattern, test.path, test.expected, matched)
+		}
+	}
+}
+
+func TestRelevantFile(t *testing.T) {
+	filter := config.GerritPathFilterConfiguration{
+		Include: []string{"typo3/**", "composer.json"},
+		Exclude: []string{"**/*.md", "typo3/sysext/*/Documentation/**"},
+	}
+
+	docs := []view.File{
+		{Path: "typo3/sysext/core/Documentation/Changelog/Feature.rst"},
+		{Path: "typo3/README.md"},
+		{Path: "Build/travis.yml"},
+	}
+	if path, relevant := relevantFile(filter, docs); relevant {
+		t.Errorf("Expected no relevant file, got %s", path)
+	}
+
+	renamed := append(docs, view.File{Path: "Build/Classes/Cache.php", OldPath: "typo3/sysext/core/Classes/Cache.php", Status: "R"})
+	if path, relevant := relevantFile(filter, renamed); !relevant || path != "typo3/sysext/core/Classes/Cache.php" {
+		t.Errorf("Expected the old path of the renamed file to be relevant, got %s", path)
+	}
+
+	// Only the commit message changed
+	if _, relevant := relevantFile(filter, nil); !relevant {
+		t.Error("Expected a patchset without files to be relevant")
+	}
+}
+
+func TestVerifyPatchsetSkipsIrrelevantChanges(t *testing.T) {
+	var reviews []map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/changes/I123/":
+			fmt.Fprint(w, `{"status": "NEW", "current_revision": "abc", "revisions": {"abc": {"_number": 1, "files": {"Documentation/Index.rst": {}}}}}`)
+		case "/a/changes/I123/revisions/abc/review":
+			var review map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&review)
+			reviews = append(reviews, review)
+		default:
+			fmt.Fprint(w, `{}`)
+		}
+	}))
+	defer ts.Close()
+
+	vote := 1
+	c := new(config.Configuration)
+	c.Gerrit.URL = ts.URL
+	c.Gerrit.Projects = map[string]map[string]bool{"Packages/TYPO3.CMS": {}}
+	c.Gerrit.PathFilters = map[string]map[string]config.GerritPathFilterConfiguration{
+		"Packages/TYPO3.CMS": {"*": {
+			Exclude:     []string{"Documentation/**"},
+			SkipMessage: config.Lines{"Skipped, {{ len .Details.Files }} documentation file(s) changed."},
+			SkipVote:    &vote,
+		}},
+	}
+	m := gerrit.Message{
+		Type:     "patchset-created",
+		Change:   gerrit.Change{ID: "I123", Project: "Packages/TYPO3.CMS", Branch: "master"},
+		Patchset: gerrit.Patchset{Revision: "abc", Number: 1},
+	}
+	trap := NewGotrap(c, m, job.NewRegistry(0).Add(m))
+
+	result, posted := trap.verifyPatchset()
+	if result != "skipped: no relevant files changed" {
+		t.Errorf("Expected the change to be skipped, got %q", result)
+	}
+	if posted == nil || *posted != 1 {
+		t.Errorf("Expected the posted vote 1, got %v", posted)
+	}
+	if len(reviews) != 1 || reviews[0]["message"] != "Skipped, 1 documentation file(s) changed." {
+		t.Fatalf("Expected the skip message, got %v", reviews)
+	}
+	if labels, _ := reviews[0]["labels"].(map[string]interface{}); labels["Verified"] != float64(1) {
+		t.Errorf("Expected Verified+1, got %v", reviews[0]["labels"])
+	}
+
+	// In dry-run mode, the skip message is only logged
+	c.Gotrap.DryRun = true
+	trap = NewGotrap(c, m, job.NewRegistry(0).Add(m))
+	if result, posted := trap.verifyPatchset(); result != "skipped: no relevant files changed" || posted != nil || len(reviews) != 1 {
+		t.Errorf("Expected the change to be skipped without posting, got %q and %d reviews", result, len(reviews))
+	}
+}
+
+func TestSkipIrrelevantChangeIsCanceledWithTheJob(t *testing.T) {
+	var j *job.Job
+	reviews := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/changes/I123/":
+			fmt.Fprint(w, `{"status": "NEW", "current_revision": "abc", "revisions": {"abc": {"_number": 1, "files": {"Documentation/Index.rst": {}}}}}`)
+		case "/changes/I123/revisions/abc/related":
+			// The operator cancels the job while its details are requested
+			j.Cancel()
+			fmt.Fprint(w, `{}`)
+		case "/a/changes/I123/revisions/abc/review":
+			reviews++
+		default:
+			fmt.Fprint(w, `{}`)
+		}
+	}))
+	defer ts.Close()
+
+	vote := 1
+	c := new(config.Configuration)
+	c.Gerrit.URL = ts.URL
+	c.Gerrit.Projects = map[string]map[string]bool{"Packages/TYPO3.CMS": {}}
+	c.Gerrit.PathFilters = map[string]map[string]config.GerritPathFilterConfiguration{
+		"Packages/TYPO3.CMS": {"*": {Exclude: []string{"Documentation/**"}, SkipVote: &vote}},
+	}
+	m := gerrit.Message{
+		Type:     "patchset-created",
+		Change:   gerrit.Change{ID: "I123", Project: "Packages/TYPO3.CMS", Branch: "master"},
+		Patchset: gerrit.Patchset{Revision: "abc", Number: 1},
+	}
+	j = job.NewRegistry(0).Add(m)
+	trap := NewGotrap(c, m, j)
+
+	if result, posted := trap.verifyPatchset(); result != "canceled by operator" || posted != nil || reviews != 0 {
+		t.Errorf("Expected the job to be canceled without a review, got %q and %d reviews", result, reviews)
+	}
+}
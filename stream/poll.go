@@ -0,0 +1,299 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/andygrunwald/gotrap/config"
+	"github.com/andygrunwald/gotrap/gerrit"
+	"github.com/andygrunwald/gotrap/job"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// GerritPollStream polls the REST API of Gerrit for new patchsets.
+// It is an alternative for Gerrit hosts without an event broker (or if the broker is down).
+// Every new current patchset of an open change in a configured project / branch
+// results in a synthetic "patchset-created" message.
+type GerritPollStream struct {
+	Config *config.Configuration
+
+	mu         sync.Mutex
+	dispatcher *dispatcher
+	state      *pollState
+	done       chan struct{}
+	stop       sync.Once
+}
+
+func init() {
+	Streams[StreamGerritPoll] = new(GerritPollStream)
+}
+
+func (s *GerritPollStream) Initialize(config *config.Configuration, jobs *job.Registry) {
+	s.Config = config
+	s.dispatcher = newDispatcher(config, jobs)
+	s.done = make(chan struct{})
+}
+
+// Reload swaps the configuration used for new jobs and the next poll.
+// Running jobs finish with the configuration they were started with.
+// The state file is only read on start.
+func (s *GerritPollStream) Reload(c *config.Configuration) {
+	s.mu.Lock()
+	s.Config = c
+	s.mu.Unlock()
+
+	s.dispatcher.SetConfiguration(c)
+}
+
+// configuration returns the current configuration.
+func (s *GerritPollStream) configuration() *config.Configuration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.Config
+}
+
+// Start polls Gerrit every gerrit.poll.interval seconds until Stop is called.
+func (s *GerritPollStream) Start() error {
+	state, err := loadPollState(s.configuration().Gerrit.Poll.StateFile)
+	if err != nil {
+		return err
+	}
+	s.state = state
+
+	log.Println("> Polling Gerrit for new patchsets.")
+
+	for {
+		s.poll()
+
+		interval := time.Duration(s.configuration().Gerrit.Poll.Interval) * time.Second
+		select {
+		case <-time.After(interval):
+		case <-s.done:
+			s.dispatcher.Wait()
+			return nil
+		}
+	}
+}
+
+// Stop stops polling.
+// Start returns after all running jobs are finished.
+func (s *GerritPollStream) Stop() {
+	s.stop.Do(func() {
+		close(s.done)
+	})
+}
+
+// poll queries all configured projects and branches once.
+func (s *GerritPollStream) poll() {
+	c := s.configuration()
+	client := gerrit.NewGerritClient(&c.Gerrit)
+
+	projects := make([]string, 0, len(c.Gerrit.Projects))
+	for project := range c.Gerrit.Projects {
+		projects = append(projects, project)
+	}
+	sort.Strings(projects)
+
+	for _, project := range projects {
+		// Without configured branches, all branches are covered
+		if len(c.Gerrit.Projects[project]) == 0 {
+			s.pollBranch(client, c, project, allBranches)
+			continue
+		}
+
+		branches := make([]string, 0, len(c.Gerrit.Projects[project]))
+		for branch, enabled := range c.Gerrit.Projects[project] {
+			if enabled {
+				branches = append(branches, branch)
+			}
+		}
+		sort.Strings(branches)
+
+		for _, branch := range branches {
+			s.pollBranch(client, c, project, branch)
+		}
+	}
+}
+
+// allBranches is the branch of the cursor for projects without configured branches.
+const allBranches = "*"
+
+// pollBranch dispatches all new patchsets of project / branch
+// and persists the cursor afterwards.
+// On the first poll of a branch, the open patchsets are only recorded,
+// otherwise every open change would get a pull request at once.
+func (s *GerritPollStream) pollBranch(client *gerrit.GerritInstance, c *config.Configuration, project, branch string) {
+	// Only changes updated recently can have a new patchset
+	query := fmt.Sprintf("status:open project:\"%s\" -age:%ds", project, c.Gerrit.Poll.MaxAge)
+	if branch != allBranches {
+		query += fmt.Sprintf(" branch:\"%s\"", branch)
+	}
+	changes, err := client.QueryChanges(context.Background(), query, "CURRENT_REVISION", "CURRENT_COMMIT")
+	if err != nil {
+		log.Printf("> Polling %s (%s) failed: %s", project, branch, err)
+		return
+	}
+
+	cursor, known := s.state.Cursor(project, branch)
+	if !known {
+		cursor.Advance(changes)
+		log.Printf("> Started polling %s (%s). %d existing patchsets are skipped.", project, branch, len(changes))
+		if err := s.state.Save(); err != nil {
+			log.Printf("> Saving the poll state failed: %s", err)
+		}
+		return
+	}
+
+	for _, change := range cursor.Advance(changes) {
+		m, err := client.NewPatchsetCreatedMessage(&change, 0)
+		if err != nil {
+			log.Printf("> Skipped change %d: %s", change.Number, err)
+			continue
+		}
+
+		log.Printf("> New patchset %d of change %d found", m.Patchset.Number, change.Number)
+		s.dispatcher.Dispatch(*m, func() {})
+	}
+
+	if err := s.state.Save(); err != nil {
+		log.Printf("> Saving the poll state failed: %s", err)
+	}
+}
+
+// pollState contains the cursors of all polled branches.
+// It is persisted in the state file to continue after a restart
+// without handling patchsets a second time.
+type pollState struct {
+	file string
+
+	Cursors map[string]map[string]*pollCursor `json:"cursors"`
+}
+
+// loadPollState reads the state file.
+// Without a state file (or if it doesn't exist yet), polling starts from scratch.
+func loadPollState(file string) (*pollState, error) {
+	state := &pollState{
+		file:    file,
+		Cursors: make(map[string]map[string]*pollCursor),
+	}
+	if len(file) == 0 {
+		return state, nil
+	}
+
+	content, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, state); err != nil {
+		return nil, fmt.Errorf("Reading state file %s failed: %s", file, err)
+	}
+
+	return state, nil
+}
+
+// Cursor returns the cursor of project / branch.
+// known is false, if the branch wasn't polled before and a new cursor was created.
+func (s *pollState) Cursor(project, branch string) (cursor *pollCursor, known bool) {
+	if s.Cursors[project] == nil {
+		s.Cursors[project] = make(map[string]*pollCursor)
+	}
+	if s.Cursors[project][branch] == nil {
+		s.Cursors[project][branch] = new(pollCursor)
+		return s.Cursors[project][branch], false
+	}
+
+	return s.Cursors[project][branch], true
+}
+
+// Save writes the state file.
+// The file is replaced atomically, so a crash can`t leave a broken state file behind.
+func (s *pollState) Save() error {
+	if len(s.file) == 0 {
+		return nil
+	}
+
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.file), filepath.Base(s.file))
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.file)
+}
+
+// pollCursor is the position of the poller in the patchsets of a branch.
+// Created is the creation time (by the clock of Gerrit) of the newest patchset handled.
+// Revisions are the patchsets created exactly at Created, because
+// several patchsets can share the same timestamp.
+type pollCursor struct {
+	Created   time.Time `json:"created"`
+	Revisions []string  `json:"revisions"`
+}
+
+// Advance returns the changes whose current patchset is newer than the cursor
+// (oldest patchset first) and moves the cursor behind them.
+// changes need to contain the current revision.
+func (c *pollCursor) Advance(changes []gerrit.ChangeInfo) []gerrit.ChangeInfo {
+	var found []gerrit.ChangeInfo
+	for _, change := range changes {
+		revision, ok := change.Revisions[change.CurrentRevision]
+		if !ok {
+			continue
+		}
+
+		created := revision.Created.Time
+		if created.Before(c.Created) || (created.Equal(c.Created) && c.handled(change.CurrentRevision)) {
+			continue
+		}
+		found = append(found, change)
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].Revisions[found[i].CurrentRevision].Created.Before(found[j].Revisions[found[j].CurrentRevision].Created.Time)
+	})
+
+	for _, change := range found {
+		created := change.Revisions[change.CurrentRevision].Created.Time
+		if created.After(c.Created) {
+			c.Created = created
+			c.Revisions = nil
+		}
+		c.Revisions = append(c.Revisions, change.CurrentRevision)
+	}
+
+	return found
+}
+
+func (c *pollCursor) handled(revision string) bool {
+	for _, r := range c.Revisions {
+		if r == revision {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,122 @@
+package stream
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/andygrunwald/gotrap/config"
+	"github.com/andygrunwald/gotrap/gerrit"
+	"github.com/andygrunwald/gotrap/job"
+)
+
+func changeWithRevision(number int, revision string, created time.Time) gerrit.ChangeInfo {
+	return gerrit.ChangeInfo{
+		Number:          number,
+		CurrentRevision: revision,
+		Revisions: map[string]gerrit.RevisionInfo{
+			revision: {Created: gerrit.Timestamp{Time: created}},
+		},
+	}
+}
+
+func TestPollCursorReturnsOnlyNewPatchsets(t *testing.T) {
+	base := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+	cursor := new(pollCursor)
+
+	changes := []gerrit.ChangeInfo{
+		changeWithRevision(2, "bbb", base.Add(time.Minute)),
+		changeWithRevision(1, "aaa", base),
+	}
+	found := cursor.Advance(changes)
+	if len(found) != 2 || found[0].Number != 1 || found[1].Number != 2 {
+		t.Fatalf("Expected changes 1 and 2 (oldest first), got %v", found)
+	}
+
+	// Change 3 shares the timestamp of the newest handled patchset, change 2 didn`t change
+	changes = []gerrit.ChangeInfo{
+		changeWithRevision(2, "bbb", base.Add(time.Minute)),
+		changeWithRevision(3, "ccc", base.Add(time.Minute)),
+	}
+	found = cursor.Advance(changes)
+	if len(found) != 1 || found[0].Number != 3 {
+		t.Fatalf("Expected change 3, got %v", found)
+	}
+
+	if found = cursor.Advance(changes); len(found) != 0 {
+		t.Errorf("Expected no new patchsets, got %v", found)
+	}
+}
+
+func TestPollStateIsPersisted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotrap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "poll.json")
+	created := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	state, err := loadPollState(file)
+	if err != nil {
+		t.Fatalf("Expected no error for a missing state file, got %s", err)
+	}
+	cursor, known := state.Cursor("Packages/TYPO3.CMS", "master")
+	if known {
+		t.Error("Expected an unknown branch without a state file")
+	}
+	cursor.Advance([]gerrit.ChangeInfo{changeWithRevision(1, "aaa", created)})
+	if err := state.Save(); err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	state, err = loadPollState(file)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	cursor, known = state.Cursor("Packages/TYPO3.CMS", "master")
+	if !known {
+		t.Error("Expected the branch of the state file to be known")
+	}
+	if !cursor.Created.Equal(created) || len(cursor.Revisions) != 1 || cursor.Revisions[0] != "aaa" {
+		t.Errorf("Unexpected cursor %+v", cursor)
+	}
+}
+
+func TestPollRecordsExistingPatchsetsOfAllBranchesOnFirstPoll(t *testing.T) {
+	var query string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query().Get("q")
+		fmt.Fprint(w, `[{"_number": 1, "current_revision": "aaa", "revisions": {"aaa": {"_number": 1, "created": "2017-03-01 12:00:00.000000000"}}}]`)
+	}))
+	defer ts.Close()
+
+	c := new(config.Configuration)
+	c.Gotrap.Concurrent = 1
+	c.Gerrit.URL = ts.URL
+	c.Gerrit.Projects = map[string]map[string]bool{"Packages/TYPO3.CMS": {}}
+	c.Gerrit.Poll.MaxAge = 3600
+	jobs := job.NewRegistry(0)
+
+	s := new(GerritPollStream)
+	s.Initialize(c, jobs)
+	s.state, _ = loadPollState("")
+	s.poll()
+
+	if expected := `status:open project:"Packages/TYPO3.CMS" -age:3600s`; query != expected {
+		t.Errorf("Expected query %q, got %q", expected, query)
+	}
+	if active := jobs.Active(); len(active) != 0 {
+		t.Errorf("Expected no jobs for existing patchsets, got %v", active)
+	}
+	cursor, known := s.state.Cursor("Packages/TYPO3.CMS", allBranches)
+	if !known || !cursor.handled("aaa") {
+		t.Errorf("Expected the existing patchset to be recorded, got %+v", cursor)
+	}
+}
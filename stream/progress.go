@@ -0,0 +1,66 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"github.com/andygrunwald/gotrap/view"
+	gogithub "github.com/google/go-github/github"
+	"log"
+	"strings"
+	"text/template"
+)
+
+// newProgress builds the data structure for the templates of gerrit.progress.
+// pullRequest and s can be nil, if they are not available yet.
+func (trap *Gotrap) newProgress(pullRequest *gogithub.PullRequest, s *gogithub.CombinedStatus) view.Progress {
+	progress := view.Progress{
+		Message:        view.NewMessage(trap.Message),
+		PullRequest:    view.NewPullRequest(pullRequest),
+		CombinedStatus: view.NewCombinedStatus(s),
+	}
+
+	for _, status := range progress.CombinedStatus.Statuses {
+		progress.Total++
+		if status.State != "pending" {
+			progress.Finished++
+		}
+	}
+
+	return progress
+}
+
+// postProgress posts the rendered template text as message without vote on the change.
+// Empty templates disable a milestone. The same message is never posted twice in a row.
+// With gerrit.progress.notify (default: NONE), nobody gets an email for these messages.
+// The tag of gerrit.review is used, so the messages can be filtered in Gerrit.
+func (trap *Gotrap) postProgress(name, text string, progress view.Progress) {
+	if len(strings.TrimSpace(text)) == 0 {
+		return
+	}
+
+	progressTemplate, err := template.New(name).Parse(text)
+	if err != nil {
+		log.Printf("> Error during parsing the progress message %s: %s", name, err)
+		return
+	}
+
+	msgBuffer := new(bytes.Buffer)
+	if err := progressTemplate.Execute(msgBuffer, progress); err != nil {
+		log.Printf("> Error during rendering the progress message %s: %s", name, err)
+		return
+	}
+
+	msg := msgBuffer.String()
+	if msg == trap.lastProgress {
+		return
+	}
+	trap.lastProgress = msg
+
+	// Progress messages are never a final outcome and have their own notify setting
+	review := trap.newReview(msg, "")
+	review.Notify = trap.config.Gerrit.Progress.Notify
+	review.NotifyDetails = nil
+	if err := trap.gerritClient.PostReview(context.Background(), &trap.Message, review); err != nil {
+		log.Printf("> Error during posting the progress message %s: %s", name, err)
+	}
+}
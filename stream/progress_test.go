@@ -0,0 +1,76 @@
+package stream
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andygrunwald/gotrap/config"
+	"github.com/andygrunwald/gotrap/gerrit"
+	"github.com/andygrunwald/gotrap/job"
+	gogithub "github.com/google/go-github/github"
+)
+
+func TestPostProgressWithoutVoteAndNotification(t *testing.T) {
+	var reviews []map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var review map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&review)
+		reviews = append(reviews, review)
+	}))
+	defer ts.Close()
+
+	c := new(config.Configuration)
+	c.Gerrit.URL = ts.URL
+	c.Gerrit.Progress.Notify = "NONE"
+	m := gerrit.Message{Change: gerrit.Change{ID: "I123"}, Patchset: gerrit.Patchset{Revision: "abc"}}
+	trap := NewGotrap(c, m, job.NewRegistry(0).Add(m))
+
+	s := &gogithub.CombinedStatus{
+		State: gogithub.String("pending"),
+		Statuses: []gogithub.RepoStatus{
+			{Context: gogithub.String("travis"), State: gogithub.String("success")},
+			{Context: gogithub.String("lint"), State: gogithub.String("pending")},
+		},
+	}
+	text := "CI running: {{.Finished}}/{{.Total}} contexts done"
+	trap.postProgress("status-changed", text, trap.newProgress(nil, s))
+	trap.postProgress("status-changed", text, trap.newProgress(nil, s))
+	trap.postProgress("started", "", trap.newProgress(nil, nil))
+
+	if len(reviews) != 1 {
+		t.Fatalf("Expected one message, got %v", reviews)
+	}
+	if reviews[0]["message"] != "CI running: 1/2 contexts done" || reviews[0]["notify"] != "NONE" {
+		t.Errorf("Unexpected review %v", reviews[0])
+	}
+	if _, ok := reviews[0]["labels"]; ok {
+		t.Errorf("Expected no vote, got %v", reviews[0]["labels"])
+	}
+}
+
+func TestNewReviewUsesNotifySettingOfOutcome(t *testing.T) {
+	c := new(config.Configuration)
+	c.Gerrit.Review = config.GerritReviewConfiguration{
+		Tag:                   "autogenerated:gotrap",
+		Notify:                "ALL",
+		NotifyOn:              map[string]string{"failure": "OWNER", "success": "NONE"},
+		NotifyDetails:         map[string][]string{"BCC": {"ci@typo3.org"}},
+		OmitDuplicateComments: true,
+	}
+	m := gerrit.Message{Change: gerrit.Change{Project: "Packages/TYPO3.CMS"}}
+	trap := NewGotrap(c, m, job.NewRegistry(0).Add(m))
+
+	review := trap.newReview("Tests failed", "failure")
+	if review.Notify != "OWNER" || review.Tag != "autogenerated:gotrap" || !review.OmitDuplicateComments {
+		t.Errorf("Unexpected review %+v", review)
+	}
+	if accounts := review.NotifyDetails["BCC"].Accounts; len(accounts) != 1 || accounts[0] != "ci@typo3.org" {
+		t.Errorf("Unexpected notify details %+v", review.NotifyDetails)
+	}
+
+	if review := trap.newReview("Tests failed", "error"); review.Notify != "ALL" {
+		t.Errorf("Expected the default notify setting, got %s", review.Notify)
+	}
+}
@@ -0,0 +1,143 @@
+package stream
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/andygrunwald/gotrap/config"
+	"github.com/andygrunwald/gotrap/gerrit"
+	"github.com/andygrunwald/gotrap/job"
+)
+
+// maxEventSize is the maximum size of a single event in a replay file.
+const maxEventSize = 16 * 1024 * 1024
+
+// ReplayStream reads Gerrit events (one JSON event per line) from a file or stdin.
+// It is meant for debugging and regression testing, e.g. to reproduce
+// an incident with captured AMQP payloads.
+// Start returns once all events were read and handled.
+type ReplayStream struct {
+	Config *config.Configuration
+
+	mu         sync.Mutex
+	dispatcher *dispatcher
+	done       chan struct{}
+	stop       sync.Once
+
+	// after waits between two events, like time.After
+	after func(time.Duration) <-chan time.Time
+}
+
+func init() {
+	Streams[StreamReplay] = new(ReplayStream)
+}
+
+func (s *ReplayStream) Initialize(config *config.Configuration, jobs *job.Registry) {
+	s.Config = config
+	s.dispatcher = newDispatcher(config, jobs)
+	s.done = make(chan struct{})
+	s.after = time.After
+}
+
+// Reload swaps the configuration used for new jobs.
+// Running jobs finish with the configuration they were started with.
+func (s *ReplayStream) Reload(c *config.Configuration) {
+	s.mu.Lock()
+	s.Config = c
+	s.mu.Unlock()
+
+	s.dispatcher.SetConfiguration(c)
+}
+
+// configuration returns the current configuration.
+func (s *ReplayStream) configuration() *config.Configuration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.Config
+}
+
+// Start replays all events of replay.file ("-" is stdin).
+func (s *ReplayStream) Start() error {
+	var input io.Reader = os.Stdin
+
+	file := s.configuration().Replay.File
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		input = f
+	}
+
+	log.Printf("> Replaying events from %s", file)
+	err := s.replay(input, func(m gerrit.Message) {
+		s.dispatcher.Dispatch(m, func() {})
+	})
+	s.dispatcher.Wait()
+
+	return err
+}
+
+// Stop stops replaying events.
+// Start returns after all running jobs are finished.
+func (s *ReplayStream) Stop() {
+	s.stop.Do(func() {
+		close(s.done)
+	})
+}
+
+// replay hands over every event of input to dispatch.
+// With replay.honor-timestamps, the time between two events (divided by replay.speed)
+// is waited before the next event is dispatched.
+func (s *ReplayStream) replay(input io.Reader, dispatch func(gerrit.Message)) error {
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), maxEventSize)
+
+	var previous time.Time
+	line := 0
+
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		change, err := decodeEvent(data)
+		// If we can`t read the event, we will skip it
+		if err != nil {
+			log.Printf("> Skipped line %d, because it can`t be read: %s", line, err)
+			continue
+		}
+
+		c := s.configuration().Replay
+		if created := eventCreatedOn(data); c.HonorTimestamps && !created.IsZero() {
+			if !previous.IsZero() && created.After(previous) {
+				delay := time.Duration(float64(created.Sub(previous)) / c.Speed)
+				select {
+				case <-s.after(delay):
+				case <-s.done:
+					return nil
+				}
+			}
+			previous = created
+		}
+
+		select {
+		case <-s.done:
+			return nil
+		default:
+		}
+
+		dispatch(change)
+	}
+
+	return scanner.Err()
+}
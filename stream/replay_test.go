@@ -0,0 +1,90 @@
+package stream
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andygrunwald/gotrap/config"
+	"github.com/andygrunwald/gotrap/gerrit"
+)
+
+func TestReplayDispatchesEventsInOrderWithScaledDelays(t *testing.T) {
+	events := strings.Join([]string{
+		`{"type": "patchset-created", "change": {"id": "I1"}, "eventCreatedOn": 1500000000}`,
+		`invalid`,
+		``,
+		`{"header": {"eventType": "comment-added", "eventCreatedOn": 1500000010}, "body": {"change": {"id": "I2"}}}`,
+		`{"type": "patchset-created", "change": {"id": "I3"}}`,
+		`{"type": "patchset-created", "change": {"id": "I4"}, "eventCreatedOn": 1500000030}`,
+	}, "\n")
+
+	tests := []struct {
+		replay config.ReplayConfiguration
+		delays []time.Duration
+	}{
+		{config.ReplayConfiguration{Speed: 1}, nil},
+		{config.ReplayConfiguration{HonorTimestamps: true, Speed: 1}, []time.Duration{10 * time.Second, 20 * time.Second}},
+		{config.ReplayConfiguration{HonorTimestamps: true, Speed: 10}, []time.Duration{time.Second, 2 * time.Second}},
+	}
+
+	for _, test := range tests {
+		var delays []time.Duration
+		s := &ReplayStream{
+			Config: &config.Configuration{Replay: test.replay},
+			done:   make(chan struct{}),
+			after: func(d time.Duration) <-chan time.Time {
+				delays = append(delays, d)
+				c := make(chan time.Time, 1)
+				c <- time.Now()
+				return c
+			},
+		}
+
+		var dispatched []string
+		err := s.replay(strings.NewReader(events), func(m gerrit.Message) {
+			dispatched = append(dispatched, m.Type+" "+m.Change.ID)
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+
+		// The malformed line and the empty line are skipped
+		expected := "patchset-created I1, comment-added I2, patchset-created I3, patchset-created I4"
+		if strings.Join(dispatched, ", ") != expected {
+			t.Errorf("Expected events %s, got %s", expected, strings.Join(dispatched, ", "))
+		}
+		if len(delays) != len(test.delays) {
+			t.Errorf("Expected delays %v, got %v", test.delays, delays)
+			continue
+		}
+		for i := range delays {
+			if delays[i] != test.delays[i] {
+				t.Errorf("Expected delays %v, got %v", test.delays, delays)
+			}
+		}
+	}
+}
+
+func TestReplayStopsWhileWaiting(t *testing.T) {
+	s := &ReplayStream{
+		Config: &config.Configuration{Replay: config.ReplayConfiguration{HonorTimestamps: true, Speed: 1}},
+		done:   make(chan struct{}),
+		after:  time.After,
+	}
+
+	events := `{"type": "patchset-created", "eventCreatedOn": 1500000000}` + "\n" +
+		`{"type": "patchset-created", "eventCreatedOn": 1500003600}`
+	dispatched := 0
+	// The second event would be dispatched one hour later
+	err := s.replay(strings.NewReader(events), func(m gerrit.Message) {
+		dispatched++
+		s.Stop()
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if dispatched != 1 {
+		t.Errorf("Expected only the first event to be dispatched, got %d", dispatched)
+	}
+}
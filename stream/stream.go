@@ -3,16 +3,29 @@ package stream
 import (
 	"errors"
 	"github.com/andygrunwald/gotrap/config"
+	"github.com/andygrunwald/gotrap/job"
 )
 
 const (
 	StreamAmqp = iota
+	StreamKafka
+	StreamGerritPoll
+	StreamReplay
 )
 
-var Streams = make(map[int]Stream, 1)
+var Streams = make(map[int]Stream, 4)
+
+// StreamTypes maps the names used in the configuration (gotrap.stream) to the stream types.
+var StreamTypes = map[string]int{
+	"amqp":        StreamAmqp,
+	"kafka":       StreamKafka,
+	"gerrit-poll": StreamGerritPoll,
+	"replay":      StreamReplay,
+}
 
 type Stream interface {
-	Initialize(*config.Configuration)
+	Initialize(*config.Configuration, *job.Registry)
+	Reload(*config.Configuration)
 	Start() error
 }
 
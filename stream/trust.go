@@ -0,0 +1,191 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/andygrunwald/gotrap/config"
+	"github.com/andygrunwald/gotrap/gerrit"
+)
+
+// checkTrust decides if the patchset of change is verified automatically.
+// Every pull request runs on the CI with its secrets, so only patchsets of trusted owners
+// uploaded by trusted accounts (member of a configured group or email domain) are verified right away.
+// Otherwise a trusted reviewer needs to approve the patchset first,
+// either with a vote on the approval label or with the keyword as comment.
+// A comment-added message only approves the patchset if its author is trusted.
+// It returns the reason of the decision.
+func (trap *Gotrap) checkTrust(ctx context.Context, change *gerrit.ChangeInfo) (bool, string, error) {
+	trust := &trap.config.Gerrit.Trust
+
+	trusted, err := trap.isTrustedAccount(ctx, change.Owner)
+	if err != nil {
+		return false, "", err
+	}
+	reason := fmt.Sprintf("owner %s is not trusted", accountName(change.Owner))
+
+	// Everybody can upload a new patchset to a change of a trusted owner
+	if trusted {
+		uploader := trap.uploader(change)
+		trusted, err = trap.isTrustedAccount(ctx, uploader)
+		if err != nil {
+			return false, "", err
+		}
+		reason = fmt.Sprintf("uploader %s is not trusted", accountName(uploader))
+	}
+	if trusted {
+		reason = fmt.Sprintf("owner %s is trusted", accountName(change.Owner))
+		// The patchset was verified when it was created
+		if trap.Message.Type == "comment-added" {
+			return false, reason, nil
+		}
+		return true, reason, nil
+	}
+
+	if trap.Message.Type == "comment-added" {
+		if trap.Message.Author == nil || !isApprovalComment(trust, trap.Message) {
+			return false, fmt.Sprintf("waiting for the approval of a trusted reviewer, %s", reason), nil
+		}
+		author := gerrit.AccountInfo{
+			Name:     trap.Message.Author.Name,
+			Email:    trap.Message.Author.Email,
+			Username: trap.Message.Author.Username,
+		}
+		trusted, err := trap.isTrustedAccount(ctx, author)
+		if err != nil {
+			return false, "", err
+		}
+		if trusted {
+			return true, fmt.Sprintf("approved by %s", accountName(author)), nil
+		}
+		return false, fmt.Sprintf("approval of %s is not trusted, %s", accountName(author), reason), nil
+	}
+
+	// Votes of trusted reviewers on the current patchset
+	if len(trust.ApprovalLabel) > 0 {
+		for _, approval := range change.Labels[trust.ApprovalLabel].All {
+			if approval.Value < trust.ApprovalValue {
+				continue
+			}
+			trusted, err := trap.isTrustedAccount(ctx, approval.AccountInfo)
+			if err != nil {
+				return false, "", err
+			}
+			if trusted {
+				return true, fmt.Sprintf("approved by %s", accountName(approval.AccountInfo)), nil
+			}
+		}
+	}
+
+	return false, fmt.Sprintf("waiting for the approval of a trusted reviewer, %s", reason), nil
+}
+
+// uploader returns the uploader of the current patchset of change.
+// Without detailed accounts, the uploader of the stream event is used.
+func (trap *Gotrap) uploader(change *gerrit.ChangeInfo) gerrit.AccountInfo {
+	uploader := change.Revisions[change.CurrentRevision].Uploader
+	if uploader.AccountID == 0 && len(uploader.Username) == 0 && len(uploader.Email) == 0 && trap.Message.Patchset.Uploader != nil {
+		uploader = gerrit.AccountInfo{
+			Name:     trap.Message.Patchset.Uploader.Name,
+			Email:    trap.Message.Patchset.Uploader.Email,
+			Username: trap.Message.Patchset.Uploader.Username,
+		}
+	}
+
+	return uploader
+}
+
+// isTrustedAccount returns true if the email domain of account
+// or one of the configured groups contains account.
+// The members of a group are only requested once per job.
+func (trap *Gotrap) isTrustedAccount(ctx context.Context, account gerrit.AccountInfo) (bool, error) {
+	trust := &trap.config.Gerrit.Trust
+
+	for _, domain := range trust.EmailDomains {
+		if len(account.Email) > 0 && strings.HasSuffix(strings.ToLower(account.Email), "@"+strings.ToLower(domain)) {
+			return true, nil
+		}
+	}
+
+	for _, group := range trust.Groups {
+		members, ok := trap.groupMembers[group]
+		if !ok {
+			var err error
+			members, err = trap.gerritClient.ListGroupMembers(ctx, group)
+			if err != nil {
+				return false, fmt.Errorf("Requesting the members of group %s failed: %s", group, err)
+			}
+			if trap.groupMembers == nil {
+				trap.groupMembers = make(map[string][]gerrit.AccountInfo)
+			}
+			trap.groupMembers[group] = members
+		}
+
+		for _, member := range members {
+			if sameAccount(member, account) {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// isApprovalComment returns true if the comment-added message m approves the verification:
+// The comment contains the keyword as a line of its own
+// or the author voted at least the approval value on the approval label with this comment.
+func isApprovalComment(trust *config.GerritTrustConfiguration, m gerrit.Message) bool {
+	if len(trust.Keyword) > 0 {
+		for _, line := range strings.Split(m.Comment, "\n") {
+			if strings.EqualFold(strings.TrimSpace(line), trust.Keyword) {
+				return true
+			}
+		}
+	}
+
+	if len(trust.ApprovalLabel) == 0 {
+		return false
+	}
+	for _, approval := range m.Approvals {
+		// Unchanged votes are part of every comment, only a new vote approves
+		if approval.Type != trust.ApprovalLabel || len(approval.OldValue) == 0 || approval.OldValue == approval.Value {
+			continue
+		}
+		if value, err := strconv.Atoi(approval.Value); err == nil && value >= trust.ApprovalValue {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sameAccount compares two accounts by id, username or email,
+// because the accounts of stream events don`t contain the id.
+func sameAccount(a, b gerrit.AccountInfo) bool {
+	switch {
+	case a.AccountID > 0 && b.AccountID > 0:
+		return a.AccountID == b.AccountID
+	case len(a.Username) > 0 && len(b.Username) > 0:
+		return a.Username == b.Username
+	case len(a.Email) > 0 && len(b.Email) > 0:
+		return strings.EqualFold(a.Email, b.Email)
+	}
+
+	return false
+}
+
+// accountName returns a readable name of account for log messages.
+func accountName(account gerrit.AccountInfo) string {
+	switch {
+	case len(account.Username) > 0:
+		return account.Username
+	case len(account.Email) > 0:
+		return account.Email
+	case len(account.Name) > 0:
+		return account.Name
+	}
+
+	return strconv.Itoa(account.AccountID)
+}
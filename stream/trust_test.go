@@ -0,0 +1,118 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andygrunwald/gotrap/config"
+	"github.com/andygrunwald/gotrap/gerrit"
+	"github.com/andygrunwald/gotrap/job"
+)
+
+func TestIsApprovalComment(t *testing.T) {
+	trust := &config.GerritTrustConfiguration{ApprovalLabel: "Code-Review", ApprovalValue: 2, Keyword: "ok-to-test"}
+
+	tests := []struct {
+		comment   string
+		approvals []gerrit.Approval
+		expected  bool
+	}{
+		{"Patch Set 2:\n\nOK-to-test", nil, true},
+		{"Patch Set 2:\n\nnot ok-to-test yet", nil, false},
+		{"Patch Set 2: Code-Review+2", []gerrit.Approval{{Type: "Code-Review", Value: "2", OldValue: "0"}}, true},
+		{"Patch Set 2: Code-Review+1", []gerrit.Approval{{Type: "Code-Review", Value: "1", OldValue: "0"}}, false},
+		{"Patch Set 2:\n\nLooks good", []gerrit.Approval{{Type: "Code-Review", Value: "2"}}, false},
+		{"Patch Set 2: Verified+1", []gerrit.Approval{{Type: "Verified", Value: "2", OldValue: "0"}}, false},
+	}
+	for _, test := range tests {
+		m := gerrit.Message{Type: "comment-added", Comment: test.comment, Approvals: test.approvals}
+		if approved := isApprovalComment(trust, m); approved != test.expected {
+			t.Errorf("Expected %q to approve: %t, got %t", test.comment, test.expected, approved)
+		}
+	}
+}
+
+func TestCheckTrust(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/a/groups/Core Team/members/" {
+			t.Errorf("Unexpected request %s", r.URL)
+		}
+		fmt.Fprint(w, `[{"_account_id": 1000097, "username": "jroe", "email": "jane.roe@example.com"}]`)
+	}))
+	defer ts.Close()
+
+	c := new(config.Configuration)
+	c.Gerrit.URL = ts.URL
+	c.Gerrit.Trust = config.GerritTrustConfiguration{
+		Enabled:       true,
+		Groups:        []string{"Core Team"},
+		EmailDomains:  []string{"typo3.org"},
+		ApprovalLabel: "Code-Review",
+		ApprovalValue: 1,
+		Keyword:       "ok-to-test",
+	}
+
+	newTrap := func(m gerrit.Message) *Gotrap {
+		return NewGotrap(c, m, job.NewRegistry(0).Add(m))
+	}
+	stranger := gerrit.AccountInfo{AccountID: 1000123, Username: "stranger", Email: "stranger@example.com"}
+	reviewer := gerrit.AccountInfo{AccountID: 1000097, Username: "jroe"}
+
+	// Owner of a trusted email domain
+	owner := gerrit.AccountInfo{Email: "john.doe@TYPO3.org"}
+	change := &gerrit.ChangeInfo{Owner: owner, CurrentRevision: "abc", Revisions: map[string]gerrit.RevisionInfo{"abc": {Uploader: owner}}}
+	if trusted, reason, _ := newTrap(gerrit.Message{Type: "patchset-created"}).checkTrust(context.Background(), change); !trusted {
+		t.Errorf("Expected the owner to be trusted, got %s", reason)
+	}
+	if trusted, _, _ := newTrap(gerrit.Message{Type: "comment-added", Comment: "ok-to-test"}).checkTrust(context.Background(), change); trusted {
+		t.Error("Expected no second verification of a trusted change")
+	}
+
+	// Untrusted uploader of a new patchset on the change of a trusted owner
+	change.Revisions["abc"] = gerrit.RevisionInfo{Uploader: stranger}
+	if trusted, reason, _ := newTrap(gerrit.Message{Type: "patchset-created"}).checkTrust(context.Background(), change); trusted || reason != "waiting for the approval of a trusted reviewer, uploader stranger is not trusted" {
+		t.Errorf("Expected the patchset to wait for an approval, got %s", reason)
+	}
+
+	// Without detailed accounts, the uploader of the event is used
+	change.Revisions["abc"] = gerrit.RevisionInfo{}
+	m := gerrit.Message{Type: "patchset-created", Patchset: gerrit.Patchset{Uploader: &gerrit.Account{Username: "stranger"}}}
+	if trusted, reason, _ := newTrap(m).checkTrust(context.Background(), change); trusted {
+		t.Errorf("Expected the uploader of the event not to be trusted, got %s", reason)
+	}
+
+	// Untrusted owner without approval
+	change = &gerrit.ChangeInfo{Owner: stranger}
+	requests = 0
+	trap := newTrap(gerrit.Message{Type: "patchset-created"})
+	if trusted, reason, err := trap.checkTrust(context.Background(), change); trusted || err != nil {
+		t.Errorf("Expected the change to wait for an approval, got %s (%v)", reason, err)
+	}
+
+	// Untrusted owner with a vote of a group member on the current patchset
+	change.Labels = map[string]gerrit.LabelInfo{"Code-Review": {All: []gerrit.ApprovalInfo{{AccountInfo: stranger, Value: 2}, {AccountInfo: reviewer, Value: 1}}}}
+	if trusted, reason, _ := trap.checkTrust(context.Background(), change); !trusted || reason != "approved by jroe" {
+		t.Errorf("Expected the change to be approved by jroe, got %s", reason)
+	}
+	if requests != 1 {
+		t.Errorf("Expected the group members to be requested once, got %d requests", requests)
+	}
+
+	// Untrusted owner with the keyword of an untrusted author, votes of trusted reviewers don`t count
+	m = gerrit.Message{Type: "comment-added", Author: &gerrit.Account{Username: "stranger"}, Comment: "Patch Set 1:\n\nok-to-test"}
+	if trusted, reason, _ := newTrap(m).checkTrust(context.Background(), change); trusted {
+		t.Errorf("Expected the comment not to approve the change, got %s", reason)
+	}
+
+	// Untrusted owner with the keyword of a group member
+	change.Labels = nil
+	m = gerrit.Message{Type: "comment-added", Author: &gerrit.Account{Username: "jroe"}, Comment: "Patch Set 1:\n\nok-to-test"}
+	if trusted, reason, _ := newTrap(m).checkTrust(context.Background(), change); !trusted {
+		t.Errorf("Expected the change to be approved, got %s", reason)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/andygrunwald/gotrap/config"
+	"github.com/andygrunwald/gotrap/gerrit"
+	"github.com/andygrunwald/gotrap/github"
+	"github.com/andygrunwald/gotrap/stream"
+)
+
+// validateCommand checks the configuration file and exits.
+// Optional the credentials for Gerrit, Github and the stream (AMQP or Kafka) are verified with read-only calls.
+//
+//	gotrap config validate --config config.json [--check-credentials]
+func validateCommand(args []string) {
+	flags := flag.NewFlagSet("config validate", flag.ExitOnError)
+	configFile := flags.String("config", "", "Path to configuration file.")
+	checkCredentials := flags.Bool("check-credentials", false, "Verify the credentials for Gerrit, Github and the stream (AMQP or Kafka) with read-only calls.")
+	flags.Parse(args)
+
+	if len(*configFile) <= 0 {
+		log.Fatal("No configuration file found. Please add the --config parameter")
+	}
+
+	config, err := config.NewConfiguration(configFile)
+	if err != nil {
+		log.Fatal("Configuration initialisation failed:", err)
+	}
+	logRedactor.SetSecrets(secrets(config)...)
+
+	if err := config.Validate(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Println("Configuration is valid.")
+
+	if !*checkCredentials {
+		return
+	}
+
+	failed := false
+	check := func(name string, verify func() error) {
+		if err := verify(); err != nil {
+			fmt.Printf("%s: Credentials rejected: %s\n", name, err)
+			failed = true
+			return
+		}
+		fmt.Printf("%s: Credentials accepted.\n", name)
+	}
+
+	check("Gerrit", gerrit.NewGerritClient(&config.Gerrit).VerifyCredentials)
+	if config.Gerrit.SSH.Enabled {
+		check("Gerrit SSH", gerrit.NewSSHReviewer(&config.Gerrit).VerifyCredentials)
+	}
+	check("Github", github.NewGithubClient(&config.Github).VerifyCredentials)
+	switch config.Gotrap.Stream {
+	case "amqp":
+		check("AMQP", (&stream.AmqpStream{Config: config}).VerifyCredentials)
+	case "kafka":
+		check("Kafka", (&stream.KafkaStream{Config: config}).VerifyCredentials)
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
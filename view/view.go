@@ -0,0 +1,313 @@
+// Package view contains the data structures available in the templates of gotrap.
+// Only the fields listed here can be used in templates. This keeps credentials
+// and internals of gotrap out of pull requests and Gerrit comments.
+package view
+
+import (
+	"github.com/andygrunwald/gotrap/gerrit"
+	"github.com/google/go-github/github"
+	"sort"
+	"strings"
+)
+
+// Message is a Gerrit stream event.
+// It is available in the templates "pull-request.title" and "pull-request.body".
+type Message struct {
+	Type     string
+	Change   Change
+	Patchset Patchset
+	// Details are empty in templates rendered before the details were requested from Gerrit
+	Details Details
+}
+
+// Change is the Gerrit change of a message.
+type Change struct {
+	Project       string
+	Branch        string
+	ID            string
+	Subject       string
+	CommitMessage string
+	URL           string
+}
+
+// Patchset is the Gerrit patchset of a message.
+type Patchset struct {
+	Ref      string
+	Revision string
+	Number   uint
+}
+
+// Details are the details of a change requested from the REST API of Gerrit.
+type Details struct {
+	Number         int
+	Owner          Account
+	Topic          string
+	Hashtags       []string
+	WorkInProgress bool
+	Private        bool
+	Insertions     int
+	Deletions      int
+	// Labels are the labels of the change by name (e.g. "Code-Review")
+	Labels map[string]Label
+	// Files are the files modified by the current patchset, sorted by path
+	Files []File
+	// Parents are the parent commits of the current patchset
+	Parents        []Commit
+	RelatedChanges []RelatedChange
+}
+
+// Account is a Gerrit user.
+type Account struct {
+	Name     string
+	Email    string
+	Username string
+}
+
+// Label is a review label of a change.
+// Approved, Rejected, Recommended and Disliked are nil, if nobody voted this way.
+type Label struct {
+	Approved    *Account
+	Rejected    *Account
+	Recommended *Account
+	Disliked    *Account
+	Blocking    bool
+	Votes       []Vote
+}
+
+// Vote is the vote of a single user on a label.
+type Vote struct {
+	Account Account
+	Value   int
+}
+
+// File is a file modified by a patchset.
+// Status is A (added), D (deleted), R (renamed), C (copied), W (rewritten) or M (modified).
+type File struct {
+	Path          string
+	OldPath       string
+	Status        string
+	Binary        bool
+	LinesInserted int
+	LinesDeleted  int
+}
+
+// Commit is a git commit.
+type Commit struct {
+	Commit  string
+	Subject string
+}
+
+// RelatedChange is a change which depends on the patchset or which the patchset depends on.
+type RelatedChange struct {
+	Project               string
+	ChangeID              string
+	Number                int
+	PatchsetNumber        int
+	CurrentPatchsetNumber int
+	Status                string
+	Commit                Commit
+}
+
+// PullRequest is the pull request created at Github.
+type PullRequest struct {
+	Number  int
+	Title   string
+	HTMLURL string
+	State   string
+}
+
+// CombinedStatus is the combined commit status of a pull request.
+type CombinedStatus struct {
+	State      string
+	SHA        string
+	TotalCount int
+	Statuses   []Status
+}
+
+// Status is the commit status of a single context (e.g. Travis CI).
+type Status struct {
+	Context     string
+	State       string
+	Description string
+	TargetURL   string
+}
+
+// Result is the outcome of a pull request.
+// It is available in the template "gerrit.comment".
+type Result struct {
+	Message        Message
+	PullRequest    PullRequest
+	CombinedStatus CombinedStatus
+}
+
+// Progress is the intermediate state of a verification.
+// It is available in the templates of "gerrit.progress".
+// PullRequest and CombinedStatus are empty until the pull request was created
+// and the first commit status was received.
+type Progress struct {
+	Message        Message
+	PullRequest    PullRequest
+	CombinedStatus CombinedStatus
+	// Finished is the number of status contexts which are not pending anymore
+	Finished int
+	// Total is the number of known status contexts
+	Total int
+}
+
+// Close is available in the template "pull-request.close".
+type Close struct {
+	Message     Message
+	PullRequest PullRequest
+}
+
+// NewMessage returns the view of the Gerrit message m.
+func NewMessage(m gerrit.Message) Message {
+	return Message{
+		Type: m.Type,
+		Change: Change{
+			Project:       m.Change.Project,
+			Branch:        m.Change.Branch,
+			ID:            m.Change.ID,
+			Subject:       m.Change.Subject,
+			CommitMessage: m.Change.CommitMessage,
+			URL:           m.Change.URL,
+		},
+		Patchset: Patchset{
+			Ref:      m.Patchset.Ref,
+			Revision: m.Patchset.Revision,
+			Number:   m.Patchset.Number,
+		},
+		Details: NewDetails(m.Details),
+	}
+}
+
+// NewDetails returns the view of the change details d.
+func NewDetails(d *gerrit.ChangeDetails) Details {
+	if d == nil || d.Change == nil {
+		return Details{}
+	}
+	c := d.Change
+
+	details := Details{
+		Number:         c.Number,
+		Owner:          newAccount(c.Owner),
+		Topic:          c.Topic,
+		Hashtags:       c.Hashtags,
+		WorkInProgress: c.WorkInProgress,
+		Private:        c.IsPrivate,
+		Insertions:     c.Insertions,
+		Deletions:      c.Deletions,
+		Labels:         make(map[string]Label, len(c.Labels)),
+	}
+
+	for name, l := range c.Labels {
+		label := Label{
+			Approved:    newAccountPointer(l.Approved),
+			Rejected:    newAccountPointer(l.Rejected),
+			Recommended: newAccountPointer(l.Recommended),
+			Disliked:    newAccountPointer(l.Disliked),
+			Blocking:    l.Blocking,
+		}
+		for _, approval := range l.All {
+			label.Votes = append(label.Votes, Vote{Account: newAccount(approval.AccountInfo), Value: approval.Value})
+		}
+		details.Labels[name] = label
+	}
+
+	revision := c.Revisions[c.CurrentRevision]
+	for path, f := range revision.Files {
+		// Magic files like "/COMMIT_MSG" are no real files
+		if strings.HasPrefix(path, "/") {
+			continue
+		}
+
+		status := f.Status
+		if len(status) == 0 {
+			status = "M"
+		}
+		details.Files = append(details.Files, File{
+			Path:          path,
+			OldPath:       f.OldPath,
+			Status:        status,
+			Binary:        f.Binary,
+			LinesInserted: f.LinesInserted,
+			LinesDeleted:  f.LinesDeleted,
+		})
+	}
+	sort.Slice(details.Files, func(i, j int) bool {
+		return details.Files[i].Path < details.Files[j].Path
+	})
+
+	for _, parent := range revision.Commit.Parents {
+		details.Parents = append(details.Parents, Commit{Commit: parent.Commit, Subject: parent.Subject})
+	}
+
+	for _, r := range d.Related {
+		details.RelatedChanges = append(details.RelatedChanges, RelatedChange{
+			Project:               r.Project,
+			ChangeID:              r.ChangeID,
+			Number:                r.Number,
+			PatchsetNumber:        r.RevisionNumber,
+			CurrentPatchsetNumber: r.CurrentRevisionNumber,
+			Status:                r.Status,
+			Commit:                Commit{Commit: r.Commit.Commit, Subject: r.Commit.Subject},
+		})
+	}
+
+	return details
+}
+
+func newAccount(a gerrit.AccountInfo) Account {
+	return Account{
+		Name:     a.Name,
+		Email:    a.Email,
+		Username: a.Username,
+	}
+}
+
+func newAccountPointer(a *gerrit.AccountInfo) *Account {
+	if a == nil {
+		return nil
+	}
+
+	account := newAccount(*a)
+	return &account
+}
+
+// NewPullRequest returns the view of the Github pull request pr.
+func NewPullRequest(pr *github.PullRequest) PullRequest {
+	if pr == nil {
+		return PullRequest{}
+	}
+
+	return PullRequest{
+		Number:  pr.GetNumber(),
+		Title:   pr.GetTitle(),
+		HTMLURL: pr.GetHTMLURL(),
+		State:   pr.GetState(),
+	}
+}
+
+// NewCombinedStatus returns the view of the Github combined status s.
+func NewCombinedStatus(s *github.CombinedStatus) CombinedStatus {
+	if s == nil {
+		return CombinedStatus{}
+	}
+
+	statuses := make([]Status, 0, len(s.Statuses))
+	for _, status := range s.Statuses {
+		statuses = append(statuses, Status{
+			Context:     status.GetContext(),
+			State:       status.GetState(),
+			Description: status.GetDescription(),
+			TargetURL:   status.GetTargetURL(),
+		})
+	}
+
+	return CombinedStatus{
+		State:      s.GetState(),
+		SHA:        s.GetSHA(),
+		TotalCount: s.GetTotalCount(),
+		Statuses:   statuses,
+	}
+}
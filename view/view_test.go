@@ -0,0 +1,36 @@
+package view
+
+import (
+	"testing"
+
+	"github.com/andygrunwald/gotrap/gerrit"
+)
+
+func TestNewDetails(t *testing.T) {
+	details := NewDetails(&gerrit.ChangeDetails{
+		Change: &gerrit.ChangeInfo{
+			Owner:           gerrit.AccountInfo{Name: "John Doe"},
+			CurrentRevision: "abc",
+			Revisions: map[string]gerrit.RevisionInfo{
+				"abc": {Files: map[string]gerrit.FileInfo{
+					"/COMMIT_MSG": {Status: "A"},
+					"b.php":       {},
+					"a.php":       {Status: "A"},
+				}},
+			},
+		},
+	})
+
+	if details.Owner.Name != "John Doe" {
+		t.Errorf("Expected owner John Doe, got %+v", details.Owner)
+	}
+	if len(details.Files) != 2 || details.Files[0].Path != "a.php" || details.Files[1].Status != "M" {
+		t.Errorf("Unexpected files %+v", details.Files)
+	}
+}
+
+func TestNewDetailsWithoutChange(t *testing.T) {
+	if details := NewDetails(nil); len(details.Files) != 0 || len(details.Owner.Name) != 0 {
+		t.Errorf("Expected empty details, got %+v", details)
+	}
+}
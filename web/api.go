@@ -0,0 +1,97 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Range of the "Verified" label, which gotrap votes on.
+const (
+	minVote = -1
+	maxVote = 1
+)
+
+// finishRequest is the body of a request to force-finish a job.
+type finishRequest struct {
+	Vote    *int   `json:"vote"`
+	Message string `json:"message"`
+}
+
+// handleJobs lists all active jobs.
+//
+//	GET /api/jobs
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.Jobs.Active())
+}
+
+// handleJob shows, cancels or force-finishes a single job.
+//
+//	GET  /api/jobs/<id>
+//	POST /api/jobs/<id>/cancel
+//	POST /api/jobs/<id>/finish {"vote": -1, "message": "..."}
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/jobs/"), "/"), "/")
+
+	id, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || len(parts) > 2 {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	j, ok := s.Jobs.Get(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "Job not found")
+		return
+	}
+
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, j.Info())
+
+	case action == "cancel" && r.Method == http.MethodPost:
+		if !j.Cancel() {
+			writeError(w, http.StatusConflict, "Job is already reporting its result and can't be canceled anymore")
+			return
+		}
+		log.Printf("> Job %d canceled via API by %s", id, r.RemoteAddr)
+		writeJSON(w, http.StatusAccepted, j.Info())
+
+	case action == "finish" && r.Method == http.MethodPost:
+		var req finishRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Vote == nil {
+			writeError(w, http.StatusBadRequest, "Body needs to be a JSON object with a \"vote\"")
+			return
+		}
+		if *req.Vote < minVote || *req.Vote > maxVote {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Vote needs to be between %d and %d", minVote, maxVote))
+			return
+		}
+
+		if !j.ForceFinish(*req.Vote, req.Message) {
+			writeError(w, http.StatusConflict, "Job is already reporting its result and can't be force-finished anymore")
+			return
+		}
+		log.Printf("> Job %d force-finished via API by %s with vote %d", id, r.RemoteAddr, *req.Vote)
+		writeJSON(w, http.StatusAccepted, j.Info())
+
+	case action == "" || action == "cancel" || action == "finish":
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+	}
+}
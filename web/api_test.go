@@ -0,0 +1,112 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andygrunwald/gotrap/config"
+	"github.com/andygrunwald/gotrap/gerrit"
+	"github.com/andygrunwald/gotrap/job"
+)
+
+func newTestServer(username, password string) (*Server, *job.Registry) {
+	jobs := job.NewRegistry(10)
+	return NewServer(&config.WebConfiguration{Username: username, Password: password}, jobs), jobs
+}
+
+func request(s *Server, method, path, body, username, password string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if len(username) > 0 {
+		r.SetBasicAuth(username, password)
+	}
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, r)
+
+	return w
+}
+
+func TestAPIAuthentication(t *testing.T) {
+	s, _ := newTestServer("admin", "s3cr3t")
+
+	tests := []struct {
+		username string
+		password string
+		code     int
+	}{
+		{"", "", http.StatusUnauthorized},
+		{"admin", "wrong", http.StatusUnauthorized},
+		{"admin", "s3cr3t", http.StatusOK},
+	}
+	for _, test := range tests {
+		if w := request(s, "GET", "/api/jobs", "", test.username, test.password); w.Code != test.code {
+			t.Errorf("Expected %d for %s:%s, got %d", test.code, test.username, test.password, w.Code)
+		}
+	}
+
+	// Without configured credentials, the API is disabled
+	s, _ = newTestServer("", "")
+	if w := request(s, "GET", "/api/jobs", "", "", ""); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403, got %d", w.Code)
+	}
+}
+
+func TestAPICancelJob(t *testing.T) {
+	s, jobs := newTestServer("admin", "s3cr3t")
+	j := jobs.Add(gerrit.Message{})
+
+	if w := request(s, "GET", "/api/jobs/1/cancel", "", "admin", "s3cr3t"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", w.Code)
+	}
+	if w := request(s, "POST", "/api/jobs/1/cancel", "", "admin", "s3cr3t"); w.Code != http.StatusAccepted {
+		t.Errorf("Expected 202, got %d", w.Code)
+	}
+	if j.Context().Err() == nil {
+		t.Error("Expected the job to be canceled")
+	}
+	if w := request(s, "POST", "/api/jobs/2/cancel", "", "admin", "s3cr3t"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", w.Code)
+	}
+
+	// A job which is reporting its result can't be canceled anymore, like it can't be force-finished
+	reporting := jobs.Add(gerrit.Message{})
+	reporting.SetPhase(job.PhaseReporting)
+	if w := request(s, "POST", "/api/jobs/2/cancel", "", "admin", "s3cr3t"); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409, got %d", w.Code)
+	}
+	if reporting.Context().Err() != nil {
+		t.Error("Expected the reporting job not to be canceled")
+	}
+}
+
+func TestAPIFinishJob(t *testing.T) {
+	s, jobs := newTestServer("admin", "s3cr3t")
+	j := jobs.Add(gerrit.Message{})
+	j.Start()
+
+	if w := request(s, "POST", "/api/jobs/1/finish", `{"message": "no vote"}`, "admin", "s3cr3t"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", w.Code)
+	}
+	for _, body := range []string{`{"vote": 2}`, `{"vote": -2}`} {
+		if w := request(s, "POST", "/api/jobs/1/finish", body, "admin", "s3cr3t"); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", body, w.Code)
+		}
+	}
+	if _, _, forced := j.ForcedVote(); forced {
+		t.Error("Expected a vote out of range not to finish the job")
+	}
+	if w := request(s, "POST", "/api/jobs/1/finish", `{"vote": -1, "message": "Travis CI is down"}`, "admin", "s3cr3t"); w.Code != http.StatusAccepted {
+		t.Errorf("Expected 202, got %d", w.Code)
+	}
+	if vote, msg, forced := j.ForcedVote(); !forced || vote != -1 || msg != "Travis CI is down" {
+		t.Errorf("Unexpected forced vote %d %q %t", vote, msg, forced)
+	}
+
+	// A job which is reporting its result can't be force-finished anymore
+	reporting := jobs.Add(gerrit.Message{})
+	reporting.SetPhase(job.PhaseReporting)
+	if w := request(s, "POST", "/api/jobs/2/finish", `{"vote": 0}`, "admin", "s3cr3t"); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409, got %d", w.Code)
+	}
+}
@@ -0,0 +1,113 @@
+package web
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/andygrunwald/gotrap/job"
+)
+
+// dashboardData is the data structure available in the dashboard template.
+type dashboardData struct {
+	Queued   []job.Info
+	Running  []job.Info
+	Finished []job.Info
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"duration": func(d time.Duration) string {
+		return (d / time.Second * time.Second).String()
+	},
+	"vote": func(v *int) string {
+		if v == nil {
+			return "-"
+		}
+		if *v > 0 {
+			return "+" + strconv.Itoa(*v)
+		}
+		return strconv.Itoa(*v)
+	},
+	"time": func(t time.Time) string {
+		return t.Format("2006-01-02 15:04:05")
+	},
+}).Parse(dashboardHTML))
+
+// handleDashboard renders a read-only overview of queued, running and recently finished jobs.
+//
+//	GET /
+func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data := dashboardData{
+		Finished: s.Jobs.History(),
+	}
+	for _, j := range s.Jobs.Active() {
+		if j.Phase == job.PhaseQueued {
+			data.Queued = append(data.Queued, j)
+		} else {
+			data.Running = append(data.Running, j)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplate.Execute(w, data); err != nil {
+		log.Printf("> Error during rendering the dashboard: %s", err)
+	}
+}
+
+const dashboardHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="30">
+<title>gotrap</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2em; }
+th, td { border-bottom: 1px solid #ddd; padding: 0.4em; text-align: left; vertical-align: top; }
+ul { margin: 0; padding-left: 1em; }
+.success { color: #2a7d2a; } .failure, .error { color: #b52a2a; } .pending { color: #a07800; }
+</style>
+</head>
+<body>
+<h1>gotrap</h1>
+{{define "jobs"}}
+<table>
+<tr><th>Change</th><th>Patchset</th><th>Project / Branch</th><th>Phase</th><th>Pull request</th><th>Statuses</th><th>Queued at</th><th>Duration</th><th>Vote</th><th>Result</th></tr>
+{{range .}}
+<tr>
+<td><a href="{{.ChangeURL}}">{{.Subject}}</a></td>
+<td>{{.Patchset}}</td>
+<td>{{.Project}} / {{.Branch}}</td>
+<td>{{.Phase}}</td>
+<td>{{if .PullRequestURL}}<a href="{{.PullRequestURL}}">{{.PullRequestURL}}</a>{{else}}-{{end}}</td>
+<td>{{if .Statuses}}<ul>{{range .Statuses}}<li class="{{.State}}">{{if .TargetURL}}<a href="{{.TargetURL}}">{{.Context}}</a>{{else}}{{.Context}}{{end}}: {{.State}}</li>{{end}}</ul>{{else}}-{{end}}</td>
+<td>{{time .QueuedAt}}</td>
+<td>{{duration .Duration}}</td>
+<td>{{vote .Vote}}</td>
+<td>{{.Result}}</td>
+</tr>
+{{else}}
+<tr><td colspan="10">Nothing here.</td></tr>
+{{end}}
+</table>
+{{end}}
+<h2>Queued</h2>
+{{template "jobs" .Queued}}
+<h2>Running</h2>
+{{template "jobs" .Running}}
+<h2>Recently finished</h2>
+{{template "jobs" .Finished}}
+</body>
+</html>
+`
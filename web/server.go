@@ -0,0 +1,87 @@
+// Package web provides the HTTP interface of gotrap.
+// It contains a public, read-only dashboard of recent verifications
+// and an authenticated API to inspect and control running jobs.
+package web
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/andygrunwald/gotrap/config"
+	"github.com/andygrunwald/gotrap/job"
+)
+
+// Server is the HTTP server of gotrap.
+// Config contains the web configuration.
+// Jobs is the registry of all jobs gotrap is working on.
+type Server struct {
+	Config *config.WebConfiguration
+	Jobs   *job.Registry
+}
+
+// NewServer returns a new HTTP server.
+func NewServer(c *config.WebConfiguration, jobs *job.Registry) *Server {
+	return &Server{
+		Config: c,
+		Jobs:   jobs,
+	}
+}
+
+// Handler returns the HTTP handler containing all routes of the server.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleDashboard)
+	mux.Handle("/api/jobs", s.authenticate(http.HandlerFunc(s.handleJobs)))
+	mux.Handle("/api/jobs/", s.authenticate(http.HandlerFunc(s.handleJob)))
+
+	return mux
+}
+
+// ListenAndServe starts the HTTP server on the configured address.
+// It blocks until the server stops.
+func (s *Server) ListenAndServe() error {
+	log.Printf("> HTTP server listening on %s", s.Config.Listen)
+	return http.ListenAndServe(s.Config.Listen, s.Handler())
+}
+
+// authenticate protects the handler h with HTTP basic auth.
+// If no credentials are configured, the access is denied completely.
+func (s *Server) authenticate(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(s.Config.Username) == 0 || len(s.Config.Password) == 0 {
+			writeError(w, http.StatusForbidden, "API disabled, because no credentials are configured")
+			return
+		}
+
+		username, password, ok := r.BasicAuth()
+		if !ok || !equal(username, s.Config.Username) || !equal(password, s.Config.Password) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="gotrap"`)
+			writeError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// equal compares a and b in constant time.
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// writeJSON sends v JSON encoded with the status code to the client.
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("> Error during writing HTTP response: %s", err)
+	}
+}
+
+// writeError sends the error message msg JSON encoded with the status code to the client.
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}